@@ -0,0 +1,519 @@
+package iavl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+)
+
+// exportedNode is a single row carried across an ExportCheckpoint stream,
+// with its own (version, sequence) attached rather than inferred from a
+// chunk-wide starting key - a chunk ordered by (version, sequence) spans
+// multiple versions and has sequence gaps, so inferring the key from an
+// offset into the chunk produces the wrong row.
+type exportedNode struct {
+	Version  int64
+	Sequence uint32
+	IsLeaf   bool
+	Shard    int64 // tree rows only; zero and unused for leaf rows
+	Bytes    []byte
+}
+
+// ExportChunk is a self-contained slice of a checkpoint export: a run of
+// leaf and branch rows, plus enough to let an importer verify it against
+// the published head before writing it through, without needing the rest
+// of the stream.
+type ExportChunk struct {
+	Nodes []exportedNode
+	// SubtreeHash is the hash of this chunk's node bytes, in order.
+	SubtreeHash []byte
+	// RollingRoot is SubtreeHash folded into every prior chunk's
+	// RollingRoot, so the final chunk's RollingRoot is the checkpoint's
+	// verifiable head.
+	RollingRoot []byte
+	// Last marks the final chunk in the stream - the one ImportCheckpoint
+	// persists the root row after.
+	Last bool
+}
+
+const (
+	checkpointNodeKindBranch byte = iota
+	checkpointNodeKindLeaf
+)
+
+// writeExportChunk frames a chunk as [length uint32][payload], the same
+// way the WAL frames a record, so readExportChunk can pull one chunk off r
+// without buffering the rest of the stream first.
+func writeExportChunk(w io.Writer, chunk ExportChunk) error {
+	buf := &bytes.Buffer{}
+	last := byte(0)
+	if chunk.Last {
+		last = 1
+	}
+	buf.WriteByte(last)
+	if err := binary.Write(buf, binary.BigEndian, uint32(len(chunk.Nodes))); err != nil {
+		return err
+	}
+	for _, n := range chunk.Nodes {
+		kind := checkpointNodeKindBranch
+		if n.IsLeaf {
+			kind = checkpointNodeKindLeaf
+		}
+		buf.WriteByte(kind)
+		if err := binary.Write(buf, binary.BigEndian, n.Shard); err != nil {
+			return err
+		}
+		if err := binary.Write(buf, binary.BigEndian, n.Version); err != nil {
+			return err
+		}
+		if err := binary.Write(buf, binary.BigEndian, n.Sequence); err != nil {
+			return err
+		}
+		if err := binary.Write(buf, binary.BigEndian, uint32(len(n.Bytes))); err != nil {
+			return err
+		}
+		buf.Write(n.Bytes)
+	}
+	buf.Write(chunk.SubtreeHash)
+	buf.Write(chunk.RollingRoot)
+
+	if err := binary.Write(w, binary.BigEndian, uint32(buf.Len())); err != nil {
+		return fmt.Errorf("failed to write checkpoint chunk length; %w", err)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// readExportChunk reads one chunk framed by writeExportChunk. A clean
+// end-of-stream (no bytes read yet for this chunk) returns io.EOF
+// unwrapped, so callers can use it as a loop terminator the way io.Reader
+// conventionally allows.
+func readExportChunk(r io.Reader) (ExportChunk, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return ExportChunk{}, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return ExportChunk{}, fmt.Errorf("failed to read checkpoint chunk payload; %w", err)
+	}
+	buf := bytes.NewReader(payload)
+
+	lastByte, err := buf.ReadByte()
+	if err != nil {
+		return ExportChunk{}, fmt.Errorf("failed to read checkpoint chunk last-flag; %w", err)
+	}
+	var count uint32
+	if err := binary.Read(buf, binary.BigEndian, &count); err != nil {
+		return ExportChunk{}, fmt.Errorf("failed to read checkpoint chunk node count; %w", err)
+	}
+	chunk := ExportChunk{Last: lastByte != 0, Nodes: make([]exportedNode, 0, count)}
+	for i := uint32(0); i < count; i++ {
+		kind, err := buf.ReadByte()
+		if err != nil {
+			return ExportChunk{}, fmt.Errorf("failed to read checkpoint node kind; %w", err)
+		}
+		var (
+			shard, version  int64
+			sequence, bzLen uint32
+		)
+		if err := binary.Read(buf, binary.BigEndian, &shard); err != nil {
+			return ExportChunk{}, err
+		}
+		if err := binary.Read(buf, binary.BigEndian, &version); err != nil {
+			return ExportChunk{}, err
+		}
+		if err := binary.Read(buf, binary.BigEndian, &sequence); err != nil {
+			return ExportChunk{}, err
+		}
+		if err := binary.Read(buf, binary.BigEndian, &bzLen); err != nil {
+			return ExportChunk{}, err
+		}
+		bz := make([]byte, bzLen)
+		if _, err := io.ReadFull(buf, bz); err != nil {
+			return ExportChunk{}, fmt.Errorf("failed to read checkpoint node bytes; %w", err)
+		}
+		chunk.Nodes = append(chunk.Nodes, exportedNode{
+			Version:  version,
+			Sequence: sequence,
+			IsLeaf:   kind == checkpointNodeKindLeaf,
+			Shard:    shard,
+			Bytes:    bz,
+		})
+	}
+	chunk.SubtreeHash = make([]byte, sha256.Size)
+	if _, err := io.ReadFull(buf, chunk.SubtreeHash); err != nil {
+		return ExportChunk{}, fmt.Errorf("failed to read checkpoint subtree hash; %w", err)
+	}
+	chunk.RollingRoot = make([]byte, sha256.Size)
+	if _, err := io.ReadFull(buf, chunk.RollingRoot); err != nil {
+		return ExportChunk{}, fmt.Errorf("failed to read checkpoint rolling root; %w", err)
+	}
+	return chunk, nil
+}
+
+// latestCheckpointVersion returns the most recent checkpoint version at or
+// before upTo, so ExportCheckpoint can stream a tree state an importer can
+// reconstruct without replaying any prunes past it.
+func (sql *SqliteDb) latestCheckpointVersion(upTo int64) (int64, error) {
+	stmt, err := sql.treeWrite.Prepare(
+		"SELECT version FROM root WHERE checkpoint = 1 AND version <= ? ORDER BY version DESC LIMIT 1", upTo)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare checkpoint lookup; %w", err)
+	}
+	defer stmt.Close()
+	hasRow, err := stmt.Step()
+	if err != nil {
+		return 0, err
+	}
+	if !hasRow {
+		return 0, fmt.Errorf("no checkpoint at or before version=%d", upTo)
+	}
+	var version int64
+	if err := stmt.Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// rootNodeKeyAt returns the NodeKey the root table points to for version -
+// not necessarily version itself, since a root that didn't change at a
+// commit still points at the node key it last changed at.
+func (sql *SqliteDb) rootNodeKeyAt(version int64) (NodeKey, error) {
+	stmt, err := sql.treeWrite.Prepare(
+		"SELECT node_version, node_sequence FROM root WHERE version = ?", version)
+	if err != nil {
+		return NodeKey{}, fmt.Errorf("failed to prepare root lookup; %w", err)
+	}
+	defer stmt.Close()
+	hasRow, err := stmt.Step()
+	if err != nil {
+		return NodeKey{}, err
+	}
+	if !hasRow {
+		return NodeKey{}, fmt.Errorf("no root row at version=%d", version)
+	}
+	var nodeVersion int64
+	var nodeSequence int
+	if err := stmt.Scan(&nodeVersion, &nodeSequence); err != nil {
+		return NodeKey{}, err
+	}
+	return NewNodeKey(nodeVersion, uint32(nodeSequence)), nil
+}
+
+// treeShards lists the shard numbers of every tree_<shard> table that
+// exists, so ExportCheckpoint can stream every shard instead of only the
+// one the checkpoint version itself falls in - shards older than the
+// checkpoint version still hold branch rows the tree needs.
+func (sql *SqliteDb) treeShards() ([]int64, error) {
+	stmt, err := sql.treeWrite.Prepare(
+		`SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE 'tree\_%' ESCAPE '\' ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare shard listing; %w", err)
+	}
+	defer stmt.Close()
+	var shards []int64
+	for {
+		hasRow, err := stmt.Step()
+		if err != nil {
+			return nil, err
+		}
+		if !hasRow {
+			break
+		}
+		var name string
+		if err := stmt.Scan(&name); err != nil {
+			return nil, err
+		}
+		shard, err := strconv.ParseInt(strings.TrimPrefix(name, "tree_"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse shard table name %q; %w", name, err)
+		}
+		shards = append(shards, shard)
+	}
+	return shards, nil
+}
+
+// exportSource is one ordered row cursor ExportCheckpoint drains in turn -
+// every tree_<shard> table, then the leaf table - so a chunk boundary can
+// fall in the middle of a source without the caller needing to know that.
+type exportSource struct {
+	shard  int64
+	isLeaf bool
+	rows   *sqlite3.Stmt
+}
+
+// ExportCheckpoint streams every row of the tree at its most recent
+// checkpoint version at or before upTo - branch rows from every tree_<shard>
+// table and leaf rows from leaf, all with version <= the checkpoint version
+// - in chunks of roughly chunkSize rows, writing the whole framed stream to
+// w: a header (checkpoint version, then the root's own NodeKey) followed by
+// one writeExportChunk-framed ExportChunk per chunk. The wire format lets
+// ImportCheckpoint rebuild the tree from a plain io.Reader, with no
+// in-process channel required, so the stream can cross a process or
+// network boundary the way a Cosmos SDK state-sync snapshot needs to.
+func (tree *Tree) ExportCheckpoint(w io.Writer, chunkSize int) error {
+	if chunkSize <= 0 {
+		return fmt.Errorf("chunkSize must be positive, got %d", chunkSize)
+	}
+	version, err := tree.sql.latestCheckpointVersion(tree.stagedVersion)
+	if err != nil {
+		return fmt.Errorf("failed to resolve checkpoint at or before version=%d; %w", tree.stagedVersion, err)
+	}
+	rootNodeKey, err := tree.sql.rootNodeKeyAt(version)
+	if err != nil {
+		return fmt.Errorf("failed to resolve root node key for checkpoint version=%d; %w", version, err)
+	}
+	shards, err := tree.sql.treeShards()
+	if err != nil {
+		return fmt.Errorf("failed to list tree shards; %w", err)
+	}
+
+	var sources []*exportSource
+	defer func() {
+		for _, s := range sources {
+			_ = s.rows.Close()
+		}
+	}()
+	for _, shard := range shards {
+		rows, err := tree.sql.treeWrite.Prepare(
+			fmt.Sprintf("SELECT version, sequence, bytes FROM tree_%d WHERE version <= ? ORDER BY version, sequence", shard),
+			version)
+		if err != nil {
+			return fmt.Errorf("failed to prepare checkpoint export query for shard %d; %w", shard, err)
+		}
+		sources = append(sources, &exportSource{shard: shard, rows: rows})
+	}
+	leafRows, err := tree.sql.leafWrite.Prepare(
+		"SELECT version, sequence, bytes FROM leaf WHERE version <= ? ORDER BY version, sequence", version)
+	if err != nil {
+		return fmt.Errorf("failed to prepare checkpoint export leaf query; %w", err)
+	}
+	sources = append(sources, &exportSource{isLeaf: true, rows: leafRows})
+
+	if err := binary.Write(w, binary.BigEndian, version); err != nil {
+		return fmt.Errorf("failed to write checkpoint export header; %w", err)
+	}
+	if _, err := w.Write(rootNodeKey[:]); err != nil {
+		return fmt.Errorf("failed to write checkpoint export root key; %w", err)
+	}
+
+	var (
+		nodes   []exportedNode
+		running []byte
+	)
+	flush := func(last bool) error {
+		if len(nodes) == 0 && !last {
+			return nil
+		}
+		h := sha256.New()
+		for _, n := range nodes {
+			h.Write(n.Bytes)
+		}
+		subtreeHash := h.Sum(nil)
+
+		rh := sha256.New()
+		rh.Write(running)
+		rh.Write(subtreeHash)
+		running = rh.Sum(nil)
+
+		if err := writeExportChunk(w, ExportChunk{
+			Nodes:       nodes,
+			SubtreeHash: subtreeHash,
+			RollingRoot: append([]byte(nil), running...),
+			Last:        last,
+		}); err != nil {
+			return fmt.Errorf("failed to write checkpoint chunk; %w", err)
+		}
+		nodes = nil
+		return nil
+	}
+
+	for si, src := range sources {
+		for {
+			hasRow, err := src.rows.Step()
+			if err != nil {
+				return fmt.Errorf("checkpoint export row step failed; %w", err)
+			}
+			if !hasRow {
+				break
+			}
+			var (
+				rowVersion int64
+				sequence   int
+				bz         []byte
+			)
+			if err := src.rows.Scan(&rowVersion, &sequence, &bz); err != nil {
+				return fmt.Errorf("checkpoint export row scan failed; %w", err)
+			}
+			nodes = append(nodes, exportedNode{
+				Version:  rowVersion,
+				Sequence: uint32(sequence),
+				IsLeaf:   src.isLeaf,
+				Shard:    src.shard,
+				Bytes:    bz,
+			})
+			if len(nodes) >= chunkSize {
+				if err := flush(false); err != nil {
+					return err
+				}
+			}
+		}
+		if si == len(sources)-1 {
+			if err := flush(true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ImportCheckpoint consumes a stream written by ExportCheckpoint, verifying
+// each chunk's SubtreeHash and the running RollingRoot as it arrives before
+// writing it through. Writes go straight to the tree/leaf shard a row
+// belongs to, one transaction per chunk, rather than through the normal
+// saveTree path, since an imported row is a verified copy of an existing
+// row rather than a mutation to be recomputed. Once the final chunk lands,
+// the root row is persisted and only then is the rebuilt *Tree returned, so
+// a caller never observes a partially-imported checkpoint as done.
+func (sql *SqliteDb) ImportCheckpoint(r io.Reader) (*Tree, error) {
+	var version int64
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint import header; %w", err)
+	}
+	var rootNodeKeyBz [12]byte
+	if _, err := io.ReadFull(r, rootNodeKeyBz[:]); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint import root key; %w", err)
+	}
+	rootNodeKey := NewNodeKey(
+		int64(binary.BigEndian.Uint64(rootNodeKeyBz[0:8])),
+		binary.BigEndian.Uint32(rootNodeKeyBz[8:12]))
+
+	var (
+		running []byte
+		i       int
+	)
+	for {
+		chunk, err := readExportChunk(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("checkpoint import: stream ended before the final chunk")
+			}
+			return nil, fmt.Errorf("checkpoint import: failed to read chunk %d; %w", i+1, err)
+		}
+		i++
+
+		h := sha256.New()
+		for _, n := range chunk.Nodes {
+			h.Write(n.Bytes)
+		}
+		if !bytes.Equal(h.Sum(nil), chunk.SubtreeHash) {
+			return nil, fmt.Errorf("checkpoint import: chunk %d subtree hash mismatch", i)
+		}
+		rh := sha256.New()
+		rh.Write(running)
+		rh.Write(chunk.SubtreeHash)
+		running = rh.Sum(nil)
+		if !bytes.Equal(running, chunk.RollingRoot) {
+			return nil, fmt.Errorf("checkpoint import: chunk %d rolling root mismatch, stream is non-resumable from here", i)
+		}
+
+		if err := sql.writeImportedChunk(chunk); err != nil {
+			return nil, fmt.Errorf("checkpoint import: chunk %d write; %w", i, err)
+		}
+		if chunk.Last {
+			break
+		}
+	}
+
+	rootShard, err := sql.getShard(rootNodeKey.Version())
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint import: root shard lookup; %w", err)
+	}
+	root, err := sql.loadNode(rootShard, rootNodeKey)
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint import: failed to load imported root nk=%v; %w", rootNodeKey, err)
+	}
+	if err := sql.SaveRoot(version, root, true); err != nil {
+		return nil, fmt.Errorf("checkpoint import: failed to save root; %w", err)
+	}
+	if err := sql.treeWrite.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return nil, fmt.Errorf("checkpoint import: final checkpoint; %w", err)
+	}
+
+	sql.logger.Info().Int64("version", version).Str("root", fmt.Sprintf("%x", running)).Msg("checkpoint import complete")
+	return &Tree{sql: sql, stagedRoot: root, stagedVersion: version}, nil
+}
+
+// loadNode reads a single previously-imported branch row back out of
+// tree_<shard>, so ImportCheckpoint can decode the root it just wrote
+// through into a *Node for SaveRoot without keeping every imported node
+// buffered in memory for the whole stream.
+func (sql *SqliteDb) loadNode(shard int64, nk NodeKey) (*Node, error) {
+	stmt, err := sql.treeWrite.Prepare(
+		fmt.Sprintf("SELECT bytes FROM tree_%d WHERE version = ? AND sequence = ?", shard),
+		nk.Version(), int(nk.Sequence()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare node lookup; %w", err)
+	}
+	defer stmt.Close()
+	hasRow, err := stmt.Step()
+	if err != nil {
+		return nil, err
+	}
+	if !hasRow {
+		return nil, fmt.Errorf("no row for nk=%v in tree_%d", nk, shard)
+	}
+	var bz []byte
+	if err := stmt.Scan(&bz); err != nil {
+		return nil, err
+	}
+	return MakeNode(nk[:], bz)
+}
+
+// writeImportedChunk inserts a chunk's rows into their tree_<shard> or leaf
+// table within a single transaction per connection, using each node's own
+// carried (version, sequence, shard) rather than one inferred from a
+// chunk-wide starting key.
+func (sql *SqliteDb) writeImportedChunk(chunk ExportChunk) error {
+	if err := sql.treeWrite.Begin(); err != nil {
+		return fmt.Errorf("failed to begin checkpoint import tree tx; %w", err)
+	}
+	if err := sql.leafWrite.Begin(); err != nil {
+		_ = sql.treeWrite.Rollback()
+		return fmt.Errorf("failed to begin checkpoint import leaf tx; %w", err)
+	}
+	for _, n := range chunk.Nodes {
+		if n.IsLeaf {
+			if err := sql.leafWrite.Exec(
+				"INSERT OR REPLACE INTO leaf (version, sequence, bytes) VALUES (?, ?, ?)",
+				n.Version, int(n.Sequence), n.Bytes); err != nil {
+				_ = sql.treeWrite.Rollback()
+				_ = sql.leafWrite.Rollback()
+				return fmt.Errorf("failed to insert imported leaf version=%d sequence=%d; %w", n.Version, n.Sequence, err)
+			}
+			continue
+		}
+		if err := sql.treeWrite.Exec(
+			fmt.Sprintf("INSERT OR REPLACE INTO tree_%d (version, sequence, bytes) VALUES (?, ?, ?)", n.Shard),
+			n.Version, int(n.Sequence), n.Bytes); err != nil {
+			_ = sql.treeWrite.Rollback()
+			_ = sql.leafWrite.Rollback()
+			return fmt.Errorf("failed to insert imported branch version=%d sequence=%d shard=%d; %w", n.Version, n.Sequence, n.Shard, err)
+		}
+	}
+	if err := sql.treeWrite.Commit(); err != nil {
+		_ = sql.leafWrite.Rollback()
+		return fmt.Errorf("failed to commit checkpoint import tree tx; %w", err)
+	}
+	if err := sql.leafWrite.Commit(); err != nil {
+		return fmt.Errorf("failed to commit checkpoint import leaf tx; %w", err)
+	}
+	return nil
+}
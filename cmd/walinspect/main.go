@@ -0,0 +1,22 @@
+// Command walinspect dumps the records in a wal-<seq>.log segment written
+// by the iavl v2 sqlWriter, for debugging WAL merge and recovery issues
+// without standing up a full tree.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cosmos/iavl/v2"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: walinspect <path-to-wal-segment>")
+		os.Exit(1)
+	}
+	if err := iavl.DumpWALSegment(os.Args[1], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "walinspect: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,71 @@
+package iavl
+
+import "fmt"
+
+// CommitContext carries everything a commit hook needs to treat a tree
+// write as durable: the staged version, its root hash, the exact set of
+// upserts and deletes that made up the commit, and whether it landed on a
+// checkpoint boundary.
+type CommitContext struct {
+	Version      int64
+	RootHash     []byte
+	Upserts      map[string][]byte
+	Deletes      [][]byte
+	IsCheckpoint bool
+}
+
+// OnCommit registers a callback fired once per version. Without a WAL,
+// that's from treeLoop's saveTree step, after the version's branches and
+// root row are written but before the version's WAL checkpoint and before
+// the caller blocked in saveTree is acked. Leaves are written concurrently
+// by leafLoop, so they are not necessarily durable yet when the hook runs.
+// A non-nil error there is returned from saveTree as the commit's error
+// instead of acking success; the branch and root rows already written are
+// not rolled back. With a WAL (the default), the caller already acked at the WAL
+// fsync before the hook ever runs - it fires later, from mergeLoop, once
+// the records are merged into the shards - so a non-nil error can only be
+// logged; it cannot undo an ack the caller already received. Register
+// hooks before opening the tree for writes: appends and the iteration
+// during firing share onCommit/onPrune under w.hooksMu, but a hook that
+// shows up mid-commit can still be skipped by a commit already in flight.
+func (tree *Tree) OnCommit(cb func(ctx CommitContext) error) {
+	w := tree.sql.writer
+	w.hooksMu.Lock()
+	defer w.hooksMu.Unlock()
+	w.onCommit = append(w.onCommit, cb)
+}
+
+// OnPrune registers a callback fired from commitPrune in both the tree and
+// leaf writer loops: each time a prune batch commits (at a batch boundary,
+// a deadline yield, an interrupting save/merge, or the end of the run), so
+// a single prune run can fire it several times from each loop.
+func (tree *Tree) OnPrune(cb func(prunedVersion int64) error) {
+	w := tree.sql.writer
+	w.hooksMu.Lock()
+	defer w.hooksMu.Unlock()
+	w.onPrune = append(w.onPrune, cb)
+}
+
+func (w *sqlWriter) fireOnCommit(ctx CommitContext) error {
+	w.hooksMu.Lock()
+	hooks := append([]func(CommitContext) error(nil), w.onCommit...)
+	w.hooksMu.Unlock()
+	for _, cb := range hooks {
+		if err := cb(ctx); err != nil {
+			return fmt.Errorf("commit hook rejected version=%d: %w", ctx.Version, err)
+		}
+	}
+	return nil
+}
+
+func (w *sqlWriter) fireOnPrune(prunedVersion int64) error {
+	w.hooksMu.Lock()
+	hooks := append([]func(int64) error(nil), w.onPrune...)
+	w.hooksMu.Unlock()
+	for _, cb := range hooks {
+		if err := cb(prunedVersion); err != nil {
+			return fmt.Errorf("prune hook failed for version=%d: %w", prunedVersion, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package iavl
+
+import (
+	"context"
+	"fmt"
+)
+
+// KVBackend abstracts the storage engine sqlWriter drives. SqliteDb's
+// sqlite3-specific statements (PRAGMA wal_checkpoint, the tree_<shard> DDL,
+// the leaf_orphan queries) are extracted behind this interface so that
+// operators on high-write-amplification workloads, or the test suite, can
+// opt into a different KV store without touching the tree/leaf/prune
+// channel structure in sqlWriter.
+//
+// Batches are split tree/leaf rather than one BeginBatch covering both,
+// because treeLoop and leafLoop each own their connection exclusively and
+// write concurrently; a single batch spanning both stores would force one
+// to wait on the other the same way the sqlite3.Conn sharing this backend
+// replaced did.
+type KVBackend interface {
+	// BeginTreeBatch opens a write batch for a single WAL merge or tree
+	// prune step. Only treeLoop, and mergeTreeRecords running on its
+	// behalf, may call this.
+	BeginTreeBatch(ctx context.Context) (KVTreeBatch, error)
+	// BeginLeafBatch opens a write batch for a single WAL merge or leaf
+	// prune step. Only leafLoop, and mergeLeafRecords running on its
+	// behalf, may call this.
+	BeginLeafBatch(ctx context.Context) (KVLeafBatch, error)
+	// ScanOrphans iterates orphaned branch entries with at <= atMax. The
+	// sqlite and memory backends yield them in ascending (version, sequence)
+	// order; pebbleBackend yields them in ascending (at, version, sequence)
+	// order, the order of its orphan keys.
+	ScanOrphans(ctx context.Context, atMax int64) (OrphanIterator, error)
+	// ScanLeafOrphans is ScanOrphans' counterpart for orphaned leaves.
+	ScanLeafOrphans(ctx context.Context, atMax int64) (OrphanIterator, error)
+	// Checkpoint is called after a checkpoint version is durable, so a
+	// backend can reclaim write-ahead space (e.g. sqlite's own WAL, or a
+	// pebble manual compaction).
+	Checkpoint(ctx context.Context) error
+	Close() error
+}
+
+// KVTreeBatch stages branch and orphan writes for one saveTree or tree
+// prune step.
+type KVTreeBatch interface {
+	PutBranch(shardID int64, nk NodeKey, bz []byte) error
+	DeleteBranch(shardID int64, nk NodeKey) error
+	PutOrphan(nk NodeKey, at int64) error
+	DeleteOrphan(nk NodeKey, at int64) error
+	Commit() error
+	Rollback() error
+}
+
+// KVLeafBatch stages leaf and leaf-orphan writes for one saveTree or leaf
+// prune step. Leaf orphans are tracked separately from branch orphans
+// (sqlite's leaf_orphan vs orphan tables) since they live on leafWrite, not
+// treeWrite.
+type KVLeafBatch interface {
+	PutLeaf(version int64, sequence int, bz []byte) error
+	DeleteLeaf(version int64, sequence int) error
+	DeleteOrphan(nk NodeKey, at int64) error
+	Commit() error
+	Rollback() error
+}
+
+// OrphanEntry is a single row yielded by OrphanIterator.
+type OrphanEntry struct {
+	NodeKey NodeKey
+	At      int64
+}
+
+type OrphanIterator interface {
+	Next() (OrphanEntry, bool, error)
+	Close() error
+}
+
+// BackendKind selects the KVBackend a SqliteDb drives its writes through.
+// BackendSqlite is the default and the only backend with an on-disk format
+// stable across iavl versions today; the others exist for operators opting
+// out of SQLite and for running the test suite without a filesystem.
+//
+// newSQLWriter always resolves BackendSqlite; there is no
+// SqliteDbOptions.Backend field in this tree yet to let an operator pick a
+// different kind at open time, so pebble and memory are reachable today
+// only by constructing them directly (as kv_backend_test.go does with
+// newMemoryBackend). Only part of sqlWriter goes through KVBackend: the WAL
+// merge batches and the per-row prune deletes do, while the prune loops'
+// orphan scans, the rowid-range deletes, root rows (SaveRoot) and the
+// wal_checkpoint pragmas still run on the sqlite connections directly.
+type BackendKind string
+
+const (
+	BackendSqlite BackendKind = "sqlite"
+	BackendPebble BackendKind = "pebble"
+	BackendMemory BackendKind = "memory"
+)
+
+// newKVBackend constructs the backend a SqliteDb should drive its writes
+// through, based on kind. An empty BackendKind defaults to sqlite.
+func newKVBackend(sql *SqliteDb, kind BackendKind) (KVBackend, error) {
+	switch kind {
+	case "", BackendSqlite:
+		return newSQLiteBackend(sql), nil
+	case BackendPebble:
+		return newPebbleBackend(sql.opts.Path + "-pebble")
+	case BackendMemory:
+		return newMemoryBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown kv backend %q", kind)
+	}
+}
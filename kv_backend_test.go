@@ -0,0 +1,35 @@
+package iavl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_MemoryBackend_PutScanOrphans(t *testing.T) {
+	backend := newMemoryBackend()
+	ctx := context.Background()
+
+	batch, err := backend.BeginTreeBatch(ctx)
+	require.NoError(t, err)
+
+	nk1 := NewNodeKey(1, 1)
+	nk2 := NewNodeKey(2, 1)
+	require.NoError(t, batch.PutOrphan(nk1, 1))
+	require.NoError(t, batch.PutOrphan(nk2, 2))
+	require.NoError(t, batch.Commit())
+
+	it, err := backend.ScanOrphans(ctx, 1)
+	require.NoError(t, err)
+	defer it.Close()
+
+	entry, ok, err := it.Next()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, nk1, entry.NodeKey)
+
+	_, ok, err = it.Next()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,155 @@
+package iavl
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// memoryBackend is an in-memory KVBackend with no filesystem footprint, so
+// the test suite can exercise sqlWriter's tree/leaf/prune plumbing without
+// opening a SQLite file or a pebble directory per test.
+type memoryBackend struct {
+	mu          sync.Mutex
+	branches    map[int64]map[NodeKey][]byte // shardID -> nodeKey -> bytes
+	leaves      map[NodeKey][]byte
+	orphans     map[NodeKey]int64 // nodeKey -> at; branch orphans
+	leafOrphans map[NodeKey]int64 // nodeKey -> at; leaf orphans, kept apart from orphans
+	// so a leaf and a branch sharing a (version, sequence) don't collide.
+}
+
+func newMemoryBackend() KVBackend {
+	return &memoryBackend{
+		branches:    make(map[int64]map[NodeKey][]byte),
+		leaves:      make(map[NodeKey][]byte),
+		orphans:     make(map[NodeKey]int64),
+		leafOrphans: make(map[NodeKey]int64),
+	}
+}
+
+func (b *memoryBackend) BeginTreeBatch(_ context.Context) (KVTreeBatch, error) {
+	return &memoryKVBatch{backend: b}, nil
+}
+
+func (b *memoryBackend) BeginLeafBatch(_ context.Context) (KVLeafBatch, error) {
+	return &memoryKVBatch{backend: b, isLeaf: true}, nil
+}
+
+func (b *memoryBackend) ScanLeafOrphans(_ context.Context, atMax int64) (OrphanIterator, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return scanMemoryOrphans(b.leafOrphans, atMax), nil
+}
+
+func (b *memoryBackend) ScanOrphans(_ context.Context, atMax int64) (OrphanIterator, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return scanMemoryOrphans(b.orphans, atMax), nil
+}
+
+func scanMemoryOrphans(orphans map[NodeKey]int64, atMax int64) *memoryOrphanIterator {
+	entries := make([]OrphanEntry, 0, len(orphans))
+	for nk, at := range orphans {
+		if at <= atMax {
+			entries = append(entries, OrphanEntry{NodeKey: nk, At: at})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].NodeKey.Version() != entries[j].NodeKey.Version() {
+			return entries[i].NodeKey.Version() < entries[j].NodeKey.Version()
+		}
+		return entries[i].NodeKey.Sequence() < entries[j].NodeKey.Sequence()
+	})
+	return &memoryOrphanIterator{entries: entries}
+}
+
+func (b *memoryBackend) Checkpoint(_ context.Context) error { return nil }
+
+func (b *memoryBackend) Close() error { return nil }
+
+type memoryKVBatch struct {
+	backend *memoryBackend
+	isLeaf  bool
+	puts    []func()
+}
+
+func (b *memoryKVBatch) PutLeaf(version int64, sequence int, bz []byte) error {
+	nk := NewNodeKey(version, uint32(sequence))
+	b.puts = append(b.puts, func() { b.backend.leaves[nk] = bz })
+	return nil
+}
+
+func (b *memoryKVBatch) PutBranch(shardID int64, nk NodeKey, bz []byte) error {
+	b.puts = append(b.puts, func() {
+		shard, ok := b.backend.branches[shardID]
+		if !ok {
+			shard = make(map[NodeKey][]byte)
+			b.backend.branches[shardID] = shard
+		}
+		shard[nk] = bz
+	})
+	return nil
+}
+
+func (b *memoryKVBatch) DeleteBranch(shardID int64, nk NodeKey) error {
+	b.puts = append(b.puts, func() {
+		if shard, ok := b.backend.branches[shardID]; ok {
+			delete(shard, nk)
+		}
+	})
+	return nil
+}
+
+func (b *memoryKVBatch) DeleteLeaf(version int64, sequence int) error {
+	nk := NewNodeKey(version, uint32(sequence))
+	b.puts = append(b.puts, func() { delete(b.backend.leaves, nk) })
+	return nil
+}
+
+func (b *memoryKVBatch) PutOrphan(nk NodeKey, at int64) error {
+	// Only KVTreeBatch declares PutOrphan, so this batch is never the leaf
+	// one here - always the branch orphans map.
+	b.puts = append(b.puts, func() { b.backend.orphans[nk] = at })
+	return nil
+}
+
+func (b *memoryKVBatch) DeleteOrphan(nk NodeKey, _ int64) error {
+	b.puts = append(b.puts, func() {
+		if b.isLeaf {
+			delete(b.backend.leafOrphans, nk)
+		} else {
+			delete(b.backend.orphans, nk)
+		}
+	})
+	return nil
+}
+
+func (b *memoryKVBatch) Commit() error {
+	b.backend.mu.Lock()
+	defer b.backend.mu.Unlock()
+	for _, put := range b.puts {
+		put()
+	}
+	return nil
+}
+
+func (b *memoryKVBatch) Rollback() error {
+	b.puts = nil
+	return nil
+}
+
+type memoryOrphanIterator struct {
+	entries []OrphanEntry
+	i       int
+}
+
+func (it *memoryOrphanIterator) Next() (OrphanEntry, bool, error) {
+	if it.i >= len(it.entries) {
+		return OrphanEntry{}, false, nil
+	}
+	e := it.entries[it.i]
+	it.i++
+	return e, true, nil
+}
+
+func (it *memoryOrphanIterator) Close() error { return nil }
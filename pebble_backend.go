@@ -0,0 +1,183 @@
+package iavl
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// pebbleBackend is a KVBackend for operators who want to opt out of SQLite
+// entirely, e.g. on workloads where SQLite's write amplification from
+// WAL + page cache dominates. Branches are keyed "t/<shard>/<version><seq>"
+// and leaves "l/<version><seq>", both big-endian so range scans over a
+// shard or a version come back in node order.
+type pebbleBackend struct {
+	db *pebble.DB
+}
+
+func newPebbleBackend(dir string) (KVBackend, error) {
+	db, err := pebble.Open(dir, &pebble.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pebble db at %s; %w", dir, err)
+	}
+	return &pebbleBackend{db: db}, nil
+}
+
+func branchKey(shardID, version int64, sequence int) []byte {
+	k := make([]byte, 0, 1+1+8+1+8+4)
+	k = append(k, 't', '/')
+	k = binary.BigEndian.AppendUint64(k, uint64(shardID))
+	k = append(k, '/')
+	k = binary.BigEndian.AppendUint64(k, uint64(version))
+	k = binary.BigEndian.AppendUint32(k, uint32(sequence))
+	return k
+}
+
+func leafKey(version int64, sequence int) []byte {
+	k := make([]byte, 0, 1+1+8+4)
+	k = append(k, 'l', '/')
+	k = binary.BigEndian.AppendUint64(k, uint64(version))
+	k = binary.BigEndian.AppendUint32(k, uint32(sequence))
+	return k
+}
+
+// orphanKey builds the key for a branch or leaf orphan entry, tagged with
+// its own "o/" or "p/" prefix so the two keyspaces never collide on a
+// shared (version, sequence) - see ScanOrphans/ScanLeafOrphans.
+func orphanKey(isLeaf bool, nk NodeKey, at int64) []byte {
+	k := make([]byte, 0, 1+1+8+8+4)
+	if isLeaf {
+		k = append(k, 'p', '/')
+	} else {
+		k = append(k, 'o', '/')
+	}
+	k = binary.BigEndian.AppendUint64(k, uint64(at))
+	k = binary.BigEndian.AppendUint64(k, uint64(nk.Version()))
+	k = binary.BigEndian.AppendUint32(k, nk.Sequence())
+	return k
+}
+
+// BeginTreeBatch and BeginLeafBatch each hand back an independent
+// pebble.Batch rather than sharing one, so treeLoop and leafLoop keep
+// writing concurrently the way they do against sqlite's two connections;
+// pebble's MVCC means two open batches against the same db are unproblematic.
+func (b *pebbleBackend) BeginTreeBatch(_ context.Context) (KVTreeBatch, error) {
+	return &pebbleTreeBatch{batch: b.db.NewBatch()}, nil
+}
+
+func (b *pebbleBackend) BeginLeafBatch(_ context.Context) (KVLeafBatch, error) {
+	return &pebbleLeafBatch{batch: b.db.NewBatch()}, nil
+}
+
+func (b *pebbleBackend) ScanOrphans(_ context.Context, atMax int64) (OrphanIterator, error) {
+	return b.scanOrphanPrefix('o', atMax)
+}
+
+// ScanLeafOrphans is ScanOrphans' counterpart over the "p/" keyspace, kept
+// apart from "o/" so a leaf and a branch sharing a (version, sequence)
+// don't collide or prune each other's rows out.
+func (b *pebbleBackend) ScanLeafOrphans(_ context.Context, atMax int64) (OrphanIterator, error) {
+	return b.scanOrphanPrefix('p', atMax)
+}
+
+func (b *pebbleBackend) scanOrphanPrefix(prefix byte, atMax int64) (OrphanIterator, error) {
+	lower := []byte{prefix, '/'}
+	upper := make([]byte, 0, 2+8)
+	upper = append(upper, prefix, '/')
+	upper = binary.BigEndian.AppendUint64(upper, uint64(atMax)+1)
+	it, err := b.db.NewIter(&pebble.IterOptions{LowerBound: lower, UpperBound: upper})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pebble orphan iterator; %w", err)
+	}
+	it.First()
+	return &pebbleOrphanIterator{it: it, started: true}, nil
+}
+
+func (b *pebbleBackend) Checkpoint(_ context.Context) error {
+	return b.db.Flush()
+}
+
+func (b *pebbleBackend) Close() error {
+	return b.db.Close()
+}
+
+type pebbleTreeBatch struct {
+	batch *pebble.Batch
+}
+
+func (b *pebbleTreeBatch) PutBranch(shardID int64, nk NodeKey, bz []byte) error {
+	return b.batch.Set(branchKey(shardID, nk.Version(), int(nk.Sequence())), bz, nil)
+}
+
+func (b *pebbleTreeBatch) DeleteBranch(shardID int64, nk NodeKey) error {
+	return b.batch.Delete(branchKey(shardID, nk.Version(), int(nk.Sequence())), nil)
+}
+
+func (b *pebbleTreeBatch) PutOrphan(nk NodeKey, at int64) error {
+	return b.batch.Set(orphanKey(false, nk, at), nil, nil)
+}
+
+func (b *pebbleTreeBatch) DeleteOrphan(nk NodeKey, at int64) error {
+	return b.batch.Delete(orphanKey(false, nk, at), nil)
+}
+
+func (b *pebbleTreeBatch) Commit() error {
+	return b.batch.Commit(pebble.Sync)
+}
+
+func (b *pebbleTreeBatch) Rollback() error {
+	return b.batch.Close()
+}
+
+type pebbleLeafBatch struct {
+	batch *pebble.Batch
+}
+
+func (b *pebbleLeafBatch) PutLeaf(version int64, sequence int, bz []byte) error {
+	return b.batch.Set(leafKey(version, sequence), bz, nil)
+}
+
+func (b *pebbleLeafBatch) DeleteLeaf(version int64, sequence int) error {
+	return b.batch.Delete(leafKey(version, sequence), nil)
+}
+
+// DeleteOrphan uses the "p/" keyspace, kept apart from pebbleTreeBatch's
+// "o/" - see pebbleBackend.ScanLeafOrphans.
+func (b *pebbleLeafBatch) DeleteOrphan(nk NodeKey, at int64) error {
+	return b.batch.Delete(orphanKey(true, nk, at), nil)
+}
+
+func (b *pebbleLeafBatch) Commit() error {
+	return b.batch.Commit(pebble.Sync)
+}
+
+func (b *pebbleLeafBatch) Rollback() error {
+	return b.batch.Close()
+}
+
+type pebbleOrphanIterator struct {
+	it      *pebble.Iterator
+	started bool
+}
+
+func (it *pebbleOrphanIterator) Next() (OrphanEntry, bool, error) {
+	if !it.started {
+		it.it.Next()
+	}
+	it.started = false
+	if !it.it.Valid() {
+		return OrphanEntry{}, false, it.it.Error()
+	}
+	key := it.it.Key()
+	// o/<at:8><version:8><sequence:4>
+	at := int64(binary.BigEndian.Uint64(key[2:10]))
+	version := int64(binary.BigEndian.Uint64(key[10:18]))
+	sequence := binary.BigEndian.Uint32(key[18:22])
+	return OrphanEntry{NodeKey: NewNodeKey(version, sequence), At: at}, true, nil
+}
+
+func (it *pebbleOrphanIterator) Close() error {
+	return it.it.Close()
+}
@@ -0,0 +1,106 @@
+package iavl
+
+import "fmt"
+
+// orphanRow is a single row read off the orphan/leaf_orphan cursor while
+// stepping a prune batch, kept in memory only long enough to be flushed by
+// the rowid-range delete path (the per-row path deletes each row as it is
+// read and keeps no orphanRow).
+type orphanRow struct {
+	version  int64
+	sequence int
+	shard    int64 // tree rows only; unused for leaf
+	rowID    int64 // orphan/leaf_orphan table ROWID
+}
+
+// flushTreeRowidRange materializes the batch's (shard, version, sequence)
+// triples into a temp table, then issues one
+// "DELETE FROM tree_<shard> WHERE ROWID IN (SELECT ...)" per distinct
+// shard in the batch, instead of one DELETE per row. The orphan rows
+// themselves are then removed with a single bulk delete joined against the
+// same prune_batch rows on (version, sequence).
+func (w *sqlWriter) flushTreeRowidRange(rows []orphanRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := w.sql.treeWrite.Exec("CREATE TEMP TABLE IF NOT EXISTS prune_batch (shard INTEGER, version INTEGER, sequence INTEGER)"); err != nil {
+		return fmt.Errorf("failed to create prune_batch; %w", err)
+	}
+	defer func() {
+		_ = w.sql.treeWrite.Exec("DELETE FROM prune_batch")
+	}()
+
+	shards := make(map[int64]struct{})
+	for _, r := range rows {
+		if err := w.sql.treeWrite.Exec("INSERT INTO prune_batch (shard, version, sequence) VALUES (?, ?, ?)", r.shard, r.version, r.sequence); err != nil {
+			return fmt.Errorf("failed to stage prune_batch row; %w", err)
+		}
+		shards[r.shard] = struct{}{}
+	}
+
+	for shard := range shards {
+		q := fmt.Sprintf(
+			`DELETE FROM tree_%d WHERE ROWID IN (
+				SELECT t.ROWID FROM tree_%d t
+				JOIN prune_batch p ON p.version = t.version AND p.sequence = t.sequence
+				WHERE p.shard = ?
+			)`, shard, shard)
+		if err := w.sql.treeWrite.Exec(q, shard); err != nil {
+			return fmt.Errorf("failed to rowid-range delete tree_%d; %w", shard, err)
+		}
+	}
+
+	// Deleted the same way as KVTreeBatch.DeleteOrphan's per-row path: keyed
+	// on (version, sequence) alone, via the same prune_batch temp table
+	// already staged above, rather than one bound ROWID parameter per row -
+	// pruneBatchSize rows would otherwise blow past SQLite's
+	// SQLITE_MAX_VARIABLE_NUMBER (~32766) in a single statement.
+	if err := w.sql.treeWrite.Exec(
+		`DELETE FROM orphan WHERE ROWID IN (
+			SELECT o.ROWID FROM orphan o
+			JOIN prune_batch p ON p.version = o.version AND p.sequence = o.sequence
+		)`); err != nil {
+		return fmt.Errorf("failed to bulk delete orphan rows; %w", err)
+	}
+	return nil
+}
+
+// flushLeafRowidRange is flushTreeRowidRange's unsharded counterpart for
+// the leaf table.
+func (w *sqlWriter) flushLeafRowidRange(rows []orphanRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := w.sql.leafWrite.Exec("CREATE TEMP TABLE IF NOT EXISTS prune_batch_leaf (version INTEGER, sequence INTEGER)"); err != nil {
+		return fmt.Errorf("failed to create prune_batch_leaf; %w", err)
+	}
+	defer func() {
+		_ = w.sql.leafWrite.Exec("DELETE FROM prune_batch_leaf")
+	}()
+
+	for _, r := range rows {
+		if err := w.sql.leafWrite.Exec("INSERT INTO prune_batch_leaf (version, sequence) VALUES (?, ?)", r.version, r.sequence); err != nil {
+			return fmt.Errorf("failed to stage prune_batch_leaf row; %w", err)
+		}
+	}
+
+	if err := w.sql.leafWrite.Exec(
+		`DELETE FROM leaf WHERE ROWID IN (
+			SELECT t.ROWID FROM leaf t
+			JOIN prune_batch_leaf p ON p.version = t.version AND p.sequence = t.sequence
+		)`); err != nil {
+		return fmt.Errorf("failed to rowid-range delete leaf; %w", err)
+	}
+
+	// See flushTreeRowidRange: joined on (version, sequence) via
+	// prune_batch_leaf instead of one bound ROWID per row, for the same
+	// SQLITE_MAX_VARIABLE_NUMBER reason.
+	if err := w.sql.leafWrite.Exec(
+		`DELETE FROM leaf_orphan WHERE ROWID IN (
+			SELECT o.ROWID FROM leaf_orphan o
+			JOIN prune_batch_leaf p ON p.version = o.version AND p.sequence = o.sequence
+		)`); err != nil {
+		return fmt.Errorf("failed to bulk delete leaf_orphan rows; %w", err)
+	}
+	return nil
+}
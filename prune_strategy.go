@@ -0,0 +1,134 @@
+package iavl
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PruneStrategy selects how stepPruning removes orphaned rows from a
+// shard. PerRow is the strategy the pruner has always used: one DELETE
+// per orphan row. RowidRange instead stages each batch's orphaned
+// (shard, version, sequence) keys in a temp table and issues one
+// "DELETE ... WHERE ROWID IN (SELECT ...)" per shard per batch. Hybrid
+// uses RowidRange for tree shards (few, large rows) and PerRow for leaf
+// (many, small rows), since which delete path is faster need not have the
+// same answer for both.
+//
+// Selected via sqlWriter.prune's strategy argument; the zero value is
+// PerRow so existing deployments are unaffected. There is no
+// SqliteDbOptions.PruneStrategy field yet for an operator to pick this at
+// open time - see BackendKind's doc comment in kv_backend.go for the same
+// gap on KVBackend.
+type PruneStrategy int
+
+const (
+	PruneStrategyPerRow PruneStrategy = iota
+	PruneStrategyRowidRange
+	PruneStrategyHybrid
+)
+
+func (s PruneStrategy) String() string {
+	switch s {
+	case PruneStrategyPerRow:
+		return "per-row"
+	case PruneStrategyRowidRange:
+		return "rowid-range"
+	case PruneStrategyHybrid:
+		return "hybrid"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+func (s PruneStrategy) usesRowidRangeForTree() bool {
+	return s == PruneStrategyRowidRange || s == PruneStrategyHybrid
+}
+
+func (s PruneStrategy) usesRowidRangeForLeaf() bool {
+	return s == PruneStrategyRowidRange
+}
+
+// deadlineInterval returns the duration between now and deadline, used to
+// re-arm a yield deadline at roughly the same cadence after it fires. A
+// zero deadline yields a zero interval, leaving deadline-based yielding
+// disabled.
+func deadlineInterval(deadline time.Time) time.Duration {
+	if deadline.IsZero() {
+		return 0
+	}
+	if d := time.Until(deadline); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// pruneStrategyStats accumulates wall-clock duration per strategy per loop,
+// so operators comparing PerRow against RowidRange on their own data can
+// read the answer back out instead of trusting a maintainer's guess.
+type pruneStrategyStats struct {
+	mu        sync.Mutex
+	durations map[string]time.Duration
+	counts    map[string]int64
+}
+
+func newPruneStrategyStats() *pruneStrategyStats {
+	return &pruneStrategyStats{
+		durations: make(map[string]time.Duration),
+		counts:    make(map[string]int64),
+	}
+}
+
+func (s *pruneStrategyStats) record(loop string, strategy PruneStrategy, dur time.Duration, rows int64) {
+	key := loop + ":" + strategy.String()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.durations[key] += dur
+	s.counts[key] += rows
+}
+
+// snapshot copies out durations/counts keyed by "<loop>:<strategy>", so a
+// caller comparing strategies on their own data can read a stable map back
+// without racing the writer goroutines still recording into it.
+func (s *pruneStrategyStats) snapshot() (durations map[string]time.Duration, counts map[string]int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	durations = make(map[string]time.Duration, len(s.durations))
+	counts = make(map[string]int64, len(s.counts))
+	for k, v := range s.durations {
+		durations[k] = v
+	}
+	for k, v := range s.counts {
+		counts[k] = v
+	}
+	return durations, counts
+}
+
+// recordPruneStrategy records this run's timing into w.pruneStats and logs
+// a summary, so which strategy is faster can be read back via
+// SqliteDb.PruneStrategyStats from real runs rather than guessed at.
+func (w *sqlWriter) recordPruneStrategy(loop string, strategy PruneStrategy, dur time.Duration, rows int64) {
+	if w.pruneStats == nil {
+		w.pruneStats = newPruneStrategyStats()
+	}
+	w.pruneStats.record(loop, strategy, dur, rows)
+	w.logger.Debug().
+		Str("loop", loop).
+		Str("strategy", strategy.String()).
+		Int64("rows", rows).
+		Dur("dur", dur).
+		Msg("prune strategy timing")
+}
+
+// PruneStrategyStats returns the accumulated prune duration and row count
+// per "<loop>:<strategy>" key (e.g. "tree:rowid-range"), recorded by every
+// prune run so far on this db. It is the only way to read this data back -
+// it is not part of SqliteDb's own metrics struct, since those are written
+// from saveTree's goroutine and these are written from the tree/leaf
+// writer loops instead.
+func (sql *SqliteDb) PruneStrategyStats() (durations map[string]time.Duration, counts map[string]int64) {
+	if sql.writer == nil || sql.writer.pruneStats == nil {
+		return map[string]time.Duration{}, map[string]int64{}
+	}
+	return sql.writer.pruneStats.snapshot()
+}
@@ -0,0 +1,30 @@
+package iavl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PruneStrategy_UsesRowidRange(t *testing.T) {
+	require.False(t, PruneStrategyPerRow.usesRowidRangeForTree())
+	require.False(t, PruneStrategyPerRow.usesRowidRangeForLeaf())
+
+	require.True(t, PruneStrategyRowidRange.usesRowidRangeForTree())
+	require.True(t, PruneStrategyRowidRange.usesRowidRangeForLeaf())
+
+	require.True(t, PruneStrategyHybrid.usesRowidRangeForTree())
+	require.False(t, PruneStrategyHybrid.usesRowidRangeForLeaf())
+}
+
+func Test_DeadlineInterval(t *testing.T) {
+	require.Equal(t, time.Duration(0), deadlineInterval(time.Time{}))
+
+	past := time.Now().Add(-time.Second)
+	require.Equal(t, time.Duration(0), deadlineInterval(past))
+
+	future := time.Now().Add(time.Minute)
+	d := deadlineInterval(future)
+	require.Greater(t, d, 59*time.Second)
+}
@@ -0,0 +1,148 @@
+package iavl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+)
+
+// sqliteBackend is the default KVBackend, wrapping the go-sqlite-lite
+// connections SqliteDb already opens for the tree and leaf shards. It
+// exists primarily so sqlWriter can be written against KVBackend without
+// changing the on-disk schema or the existing sqlite3.Conn lifecycle.
+type sqliteBackend struct {
+	sql *SqliteDb
+}
+
+func newSQLiteBackend(sql *SqliteDb) KVBackend {
+	return &sqliteBackend{sql: sql}
+}
+
+func (b *sqliteBackend) BeginTreeBatch(_ context.Context) (KVTreeBatch, error) {
+	if err := b.sql.treeWrite.Begin(); err != nil {
+		return nil, fmt.Errorf("failed to begin tree batch; %w", err)
+	}
+	return &sqliteTreeBatch{sql: b.sql}, nil
+}
+
+func (b *sqliteBackend) BeginLeafBatch(_ context.Context) (KVLeafBatch, error) {
+	if err := b.sql.leafWrite.Begin(); err != nil {
+		return nil, fmt.Errorf("failed to begin leaf batch; %w", err)
+	}
+	return &sqliteLeafBatch{sql: b.sql}, nil
+}
+
+func (b *sqliteBackend) ScanOrphans(_ context.Context, atMax int64) (OrphanIterator, error) {
+	stmt, err := b.sql.treeWrite.Prepare("SELECT version, sequence, at FROM orphan WHERE at <= ? ORDER BY version, sequence", atMax)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare orphan scan; %w", err)
+	}
+	return &sqliteOrphanIterator{stmt: stmt}, nil
+}
+
+func (b *sqliteBackend) ScanLeafOrphans(_ context.Context, atMax int64) (OrphanIterator, error) {
+	stmt, err := b.sql.leafWrite.Prepare("SELECT version, sequence, at FROM leaf_orphan WHERE at <= ? ORDER BY version, sequence", atMax)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare leaf orphan scan; %w", err)
+	}
+	return &sqliteOrphanIterator{stmt: stmt}, nil
+}
+
+func (b *sqliteBackend) Checkpoint(_ context.Context) error {
+	if err := b.sql.treeWrite.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("failed tree wal_checkpoint; %w", err)
+	}
+	if err := b.sql.leafWrite.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("failed leaf wal_checkpoint; %w", err)
+	}
+	return nil
+}
+
+func (b *sqliteBackend) Close() error {
+	return nil
+}
+
+type sqliteTreeBatch struct {
+	sql *SqliteDb
+}
+
+func (b *sqliteTreeBatch) PutBranch(shardID int64, nk NodeKey, bz []byte) error {
+	return b.sql.treeWrite.Exec(
+		fmt.Sprintf("INSERT OR REPLACE INTO tree_%d (version, sequence, bytes) VALUES (?, ?, ?)", shardID),
+		nk.Version(), int(nk.Sequence()), bz)
+}
+
+func (b *sqliteTreeBatch) DeleteBranch(shardID int64, nk NodeKey) error {
+	return b.sql.treeWrite.Exec(
+		fmt.Sprintf("DELETE FROM tree_%d WHERE version = ? AND sequence = ?", shardID),
+		nk.Version(), int(nk.Sequence()))
+}
+
+func (b *sqliteTreeBatch) PutOrphan(nk NodeKey, at int64) error {
+	return b.sql.treeWrite.Exec("INSERT INTO orphan (version, sequence, at) VALUES (?, ?, ?)", nk.Version(), int(nk.Sequence()), at)
+}
+
+func (b *sqliteTreeBatch) DeleteOrphan(nk NodeKey, _ int64) error {
+	return b.sql.treeWrite.Exec("DELETE FROM orphan WHERE version = ? AND sequence = ?", nk.Version(), int(nk.Sequence()))
+}
+
+func (b *sqliteTreeBatch) Commit() error {
+	if err := b.sql.treeWrite.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tree batch; %w", err)
+	}
+	return nil
+}
+
+func (b *sqliteTreeBatch) Rollback() error {
+	return b.sql.treeWrite.Rollback()
+}
+
+type sqliteLeafBatch struct {
+	sql *SqliteDb
+}
+
+func (b *sqliteLeafBatch) PutLeaf(version int64, sequence int, bz []byte) error {
+	return b.sql.leafWrite.Exec("INSERT OR REPLACE INTO leaf (version, sequence, bytes) VALUES (?, ?, ?)", version, sequence, bz)
+}
+
+func (b *sqliteLeafBatch) DeleteLeaf(version int64, sequence int) error {
+	return b.sql.leafWrite.Exec("DELETE FROM leaf WHERE version = ? AND sequence = ?", version, sequence)
+}
+
+func (b *sqliteLeafBatch) DeleteOrphan(nk NodeKey, _ int64) error {
+	return b.sql.leafWrite.Exec("DELETE FROM leaf_orphan WHERE version = ? AND sequence = ?", nk.Version(), int(nk.Sequence()))
+}
+
+func (b *sqliteLeafBatch) Commit() error {
+	if err := b.sql.leafWrite.Commit(); err != nil {
+		return fmt.Errorf("failed to commit leaf batch; %w", err)
+	}
+	return nil
+}
+
+func (b *sqliteLeafBatch) Rollback() error {
+	return b.sql.leafWrite.Rollback()
+}
+
+type sqliteOrphanIterator struct {
+	stmt *sqlite3.Stmt
+}
+
+func (it *sqliteOrphanIterator) Next() (OrphanEntry, bool, error) {
+	hasRow, err := it.stmt.Step()
+	if err != nil || !hasRow {
+		return OrphanEntry{}, false, err
+	}
+	var version int64
+	var sequence int
+	var at int64
+	if err := it.stmt.Scan(&version, &sequence, &at); err != nil {
+		return OrphanEntry{}, false, err
+	}
+	return OrphanEntry{NodeKey: NewNodeKey(version, uint32(sequence)), At: at}, true, nil
+}
+
+func (it *sqliteOrphanIterator) Close() error {
+	return it.stmt.Close()
+}
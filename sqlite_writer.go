@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bvinc/go-sqlite-lite/sqlite3"
@@ -12,9 +14,24 @@ import (
 	"github.com/rs/zerolog"
 )
 
+// rootHash is a nil-safe Node.Hash, since a version that deletes every key
+// (or an empty tree) stages a nil root - SaveRoot already tolerates that,
+// so callers that report a version's root hash must too.
+func rootHash(root *Node) []byte {
+	if root == nil {
+		return nil
+	}
+	return root.Hash()
+}
+
 type pruneSignal struct {
 	pruneVersion int64
 	checkpoints  VersionRange
+	strategy     PruneStrategy
+	// deadline, if non-zero, is checked after every pruned row so a long
+	// running prune can voluntarily yield back to saveTree signals without
+	// waiting for a full pruneBatchSize boundary.
+	deadline time.Time
 }
 
 type saveSignal struct {
@@ -22,6 +39,8 @@ type saveSignal struct {
 	root           *Node
 	version        int64
 	wantCheckpoint bool
+	upserts        map[string][]byte
+	deletes        [][]byte
 }
 
 type saveResult struct {
@@ -30,20 +49,31 @@ type saveResult struct {
 }
 
 type sqlWriter struct {
-	sql    *SqliteDb
-	logger zerolog.Logger
+	sql     *SqliteDb
+	logger  zerolog.Logger
+	wal     *walManager
+	backend KVBackend
+
+	pruneStats *pruneStrategyStats
 
 	treePruneCh chan *pruneSignal
 	treeCh      chan *saveSignal
 	treeResult  chan *saveResult
+	treeMergeCh chan *walMergeSignal
 
 	leafPruneCh chan *pruneSignal
 	leafCh      chan *saveSignal
 	leafResult  chan *saveResult
+	leafMergeCh chan *walMergeSignal
+
+	hooksMu  sync.Mutex
+	onCommit []func(CommitContext) error
+	onPrune  []func(int64) error
 }
 
 func (sql *SqliteDb) newSQLWriter() *sqlWriter {
-	return &sqlWriter{
+	logger := sql.logger.With().Str("module", "write").Logger()
+	w := &sqlWriter{
 		sql:         sql,
 		leafPruneCh: make(chan *pruneSignal),
 		treePruneCh: make(chan *pruneSignal),
@@ -51,11 +81,42 @@ func (sql *SqliteDb) newSQLWriter() *sqlWriter {
 		treeCh:      make(chan *saveSignal),
 		leafResult:  make(chan *saveResult),
 		treeResult:  make(chan *saveResult),
-		logger:      sql.logger.With().Str("module", "write").Logger(),
+		treeMergeCh: make(chan *walMergeSignal),
+		leafMergeCh: make(chan *walMergeSignal),
+		logger:      logger,
+	}
+	wal, err := newWALManager(filepath.Join(sql.opts.Path, "wal"), logger)
+	if err != nil {
+		logger.Err(err).Msg("failed to open wal manager; falling back to direct sqlite writes")
+	} else {
+		w.wal = wal
 	}
+	// There is no SqliteDbOptions field yet to pick a different backend at
+	// open time (see BackendKind's doc comment), so this always resolves
+	// to the sqlite-backed implementation; newKVBackend can't error for
+	// that kind.
+	backend, err := newKVBackend(sql, BackendSqlite)
+	if err != nil {
+		logger.Err(err).Msg("failed to construct kv backend; falling back to sqlite backend")
+		backend = newSQLiteBackend(sql)
+	}
+	w.backend = backend
+	w.pruneStats = newPruneStrategyStats()
+	return w
 }
 
 func (w *sqlWriter) start(ctx context.Context) {
+	if w.wal != nil {
+		if err := w.recoverWAL(); err != nil {
+			w.logger.Fatal().Err(err).Msg("wal recovery failed")
+		}
+		stop := make(chan struct{})
+		go func() {
+			<-ctx.Done()
+			close(stop)
+		}()
+		go w.mergeLoop(stop)
+	}
 	go func() {
 		err := w.treeLoop(ctx)
 		if err != nil {
@@ -75,31 +136,30 @@ func (w *sqlWriter) leafLoop(ctx context.Context) error {
 		pruneVersion     int64
 		nextPruneVersion int64
 		checkpoints      VersionRange
+		strategy         PruneStrategy
+		pruneDeadline    time.Time
+		pruneInterval    time.Duration
+		pruneBatchRows   []orphanRow
 		orphanQuery      *sqlite3.Stmt
-		deleteOrphan     *sqlite3.Stmt
-		deleteLeaf       *sqlite3.Stmt
+		leafBatch        KVLeafBatch
 		pruneCount       int64
 		pruneStartTime   time.Time
 		err              error
 	)
 
+	// beginPruneBatch runs the leaf_orphan scan for both delete paths
+	// directly against leafWrite, but routes the per-row delete path through
+	// w.backend's KVLeafBatch; the rowid-range path also writes to leafWrite
+	// directly.
 	beginPruneBatch := func(pruneTo int64) error {
-		if err = w.sql.leafWrite.Begin(); err != nil {
-			return fmt.Errorf("failed to begin leaf prune tx; %w", err)
-		}
-		orphanQuery, err = w.sql.leafWrite.Prepare(`SELECT version, sequence, ROWID FROM leaf_orphan WHERE at <= ?`, pruneTo)
-		if err != nil {
-			return fmt.Errorf("failed to prepare leaf orphan query; %w", err)
-		}
-		deleteOrphan, err = w.sql.leafWrite.Prepare("DELETE FROM leaf_orphan WHERE ROWID = ?")
+		leafBatch, err = w.backend.BeginLeafBatch(ctx)
 		if err != nil {
-			return fmt.Errorf("failed to prepare leaf orphan delete; %w", err)
+			return fmt.Errorf("failed to begin leaf prune batch; %w", err)
 		}
-		deleteLeaf, err = w.sql.leafWrite.Prepare("DELETE FROM leaf WHERE version = ? and sequence = ?")
+		orphanQuery, err = w.sql.leafWrite.Prepare(`SELECT version, sequence, at, ROWID FROM leaf_orphan WHERE at <= ?`, pruneTo)
 		if err != nil {
-			return fmt.Errorf("failed to prepare leaf delete; %w", err)
+			return fmt.Errorf("failed to prepare leaf orphan query; %w", err)
 		}
-
 		return nil
 	}
 	startPrune := func(startPruningVersion int64) error {
@@ -116,8 +176,9 @@ func (w *sqlWriter) leafLoop(ctx context.Context) error {
 		pruneVersion = pruneTo
 		pruneCount = 0
 		pruneStartTime = time.Now()
+		pruneBatchRows = nil
 
-		w.logger.Debug().Msgf("leaf prune starting requested=%d pruneTo=%d", startPruningVersion, pruneTo)
+		w.logger.Debug().Msgf("leaf prune starting requested=%d pruneTo=%d strategy=%s", startPruningVersion, pruneTo, strategy)
 		if err = beginPruneBatch(pruneVersion); err != nil {
 			return err
 		}
@@ -128,23 +189,37 @@ func (w *sqlWriter) leafLoop(ctx context.Context) error {
 			return err
 		}
 		orphanQuery = nil
-		if err = w.sql.leafWrite.Commit(); err != nil {
-			return err
+		if err = leafBatch.Commit(); err != nil {
+			return fmt.Errorf("failed to commit leaf prune; %w", err)
 		}
+		leafBatch = nil
 		w.logger.Debug().Msgf("commit leaf prune count=%s", humanize.Comma(pruneCount))
 		if err = w.sql.leafWrite.Exec("PRAGMA wal_checkpoint(RESTART)"); err != nil {
 			return fmt.Errorf("failed to checkpoint; %w", err)
 		}
-
-		if err = deleteLeaf.Close(); err != nil {
-			return err
-		}
-		if err = deleteOrphan.Close(); err != nil {
+		if err = w.fireOnPrune(pruneVersion); err != nil {
 			return err
 		}
 
 		return nil
 	}
+	// shouldYield reports whether this batch boundary (a pruneBatchSize
+	// multiple, or a caller-supplied deadline) has been reached. On a
+	// deadline yield, pruneDeadline is pushed out by the same interval so
+	// the next yield check lands roughly pruneInterval later, rather than
+	// firing on every remaining row.
+	shouldYield := func() bool {
+		if pruneCount%pruneBatchSize == 0 {
+			return true
+		}
+		if !pruneDeadline.IsZero() && !time.Now().Before(pruneDeadline) {
+			if pruneInterval > 0 {
+				pruneDeadline = pruneDeadline.Add(pruneInterval)
+			}
+			return true
+		}
+		return false
+	}
 	stepPruning := func() error {
 		hasRow, err := orphanQuery.Step()
 		if err != nil {
@@ -155,19 +230,35 @@ func (w *sqlWriter) leafLoop(ctx context.Context) error {
 			var (
 				version  int64
 				sequence int
+				at       int64
 				rowID    int64
 			)
-			err = orphanQuery.Scan(&version, &sequence, &rowID)
+			err = orphanQuery.Scan(&version, &sequence, &at, &rowID)
 			if err != nil {
 				return err
 			}
-			if err = deleteLeaf.Exec(version, sequence); err != nil {
-				return err
-			}
-			if err = deleteOrphan.Exec(rowID); err != nil {
-				return err
+			if strategy.usesRowidRangeForLeaf() {
+				pruneBatchRows = append(pruneBatchRows, orphanRow{version: version, sequence: sequence, rowID: rowID})
+			} else {
+				if err = leafBatch.DeleteLeaf(version, sequence); err != nil {
+					return fmt.Errorf("failed to delete leaf count=%d; %w", pruneCount, err)
+				}
+				// at must be the row's own orphaning version, not pruneVersion
+				// - a KVBackend that keys the orphan entry on at (pebble)
+				// would otherwise compute the wrong key and leave the row
+				// behind. The sqlite and memory DeleteOrphan ignore at and key
+				// on (version, sequence) alone, so this was silently fine there.
+				if err = leafBatch.DeleteOrphan(NewNodeKey(version, uint32(sequence)), at); err != nil {
+					return fmt.Errorf("failed to delete leaf orphan count=%d; %w", pruneCount, err)
+				}
 			}
-			if pruneCount%pruneBatchSize == 0 {
+			if shouldYield() {
+				if strategy.usesRowidRangeForLeaf() {
+					if err = w.flushLeafRowidRange(pruneBatchRows); err != nil {
+						return err
+					}
+					pruneBatchRows = nil
+				}
 				if err = commitPrune(); err != nil {
 					return err
 				}
@@ -176,6 +267,12 @@ func (w *sqlWriter) leafLoop(ctx context.Context) error {
 				}
 			}
 		} else {
+			if strategy.usesRowidRangeForLeaf() {
+				if err = w.flushLeafRowidRange(pruneBatchRows); err != nil {
+					return err
+				}
+				pruneBatchRows = nil
+			}
 			if err = commitPrune(); err != nil {
 				return err
 			}
@@ -188,6 +285,7 @@ func (w *sqlWriter) leafLoop(ctx context.Context) error {
 				time.Since(pruneStartTime).Round(time.Millisecond),
 				pruneVersion,
 			)
+			w.recordPruneStrategy("leaf", strategy, time.Since(pruneStartTime), pruneCount)
 			if nextPruneVersion != 0 {
 				if err = startPrune(nextPruneVersion); err != nil {
 					return err
@@ -200,6 +298,23 @@ func (w *sqlWriter) leafLoop(ctx context.Context) error {
 
 		return nil
 	}
+	// flushPendingPruneRows flushes and clears any rows accumulated for the
+	// rowid-range delete path. Every path into commitPrune must call this
+	// first - stepPruning's own yield/done branches already do, and the
+	// interrupt branches below need it too, or a RowidRange/Hybrid prune
+	// interrupted by a save/merge signal leaves pruneBatchRows stale: the
+	// rows it already scanned are never deleted, and beginPruneBatch's
+	// rescan re-appends the still-present orphans on top of them.
+	flushPendingPruneRows := func() error {
+		if !strategy.usesRowidRangeForLeaf() {
+			return nil
+		}
+		if err := w.flushLeafRowidRange(pruneBatchRows); err != nil {
+			return err
+		}
+		pruneBatchRows = nil
+		return nil
+	}
 	saveLeaves := func(sig *saveSignal) {
 		res := &saveResult{}
 		res.n, res.err = sig.batch.saveLeaves()
@@ -214,6 +329,9 @@ func (w *sqlWriter) leafLoop(ctx context.Context) error {
 		if pruneVersion != 0 {
 			select {
 			case sig := <-w.leafCh:
+				if err = flushPendingPruneRows(); err != nil {
+					return fmt.Errorf("interrupt leaf prune failed in flush; %w", err)
+				}
 				if err = commitPrune(); err != nil {
 					return fmt.Errorf("interrupt leaf prune failed in commit; %w", err)
 				}
@@ -224,7 +342,20 @@ func (w *sqlWriter) leafLoop(ctx context.Context) error {
 			case sig := <-w.leafPruneCh:
 				w.logger.Warn().Msgf("leaf prune signal received while pruning version=%d next=%d", pruneVersion, sig.pruneVersion)
 				checkpoints = sig.checkpoints
+				strategy = sig.strategy
+				pruneDeadline, pruneInterval = sig.deadline, deadlineInterval(sig.deadline)
 				nextPruneVersion = sig.pruneVersion
+			case sig := <-w.leafMergeCh:
+				if err = flushPendingPruneRows(); err != nil {
+					return fmt.Errorf("interrupt leaf prune failed in flush; %w", err)
+				}
+				if err = commitPrune(); err != nil {
+					return fmt.Errorf("interrupt leaf prune failed in commit; %w", err)
+				}
+				sig.done <- w.mergeLeafRecords(sig.batch)
+				if err = beginPruneBatch(pruneVersion); err != nil {
+					return fmt.Errorf("interrupt leaf prune failed in begin; %w", err)
+				}
 			case <-ctx.Done():
 				return nil
 			default:
@@ -237,8 +368,12 @@ func (w *sqlWriter) leafLoop(ctx context.Context) error {
 			select {
 			case sig := <-w.leafCh:
 				saveLeaves(sig)
+			case sig := <-w.leafMergeCh:
+				sig.done <- w.mergeLeafRecords(sig.batch)
 			case sig := <-w.leafPruneCh:
 				checkpoints = sig.checkpoints
+				strategy = sig.strategy
+				pruneDeadline, pruneInterval = sig.deadline, deadlineInterval(sig.deadline)
 				err = startPrune(sig.pruneVersion)
 				if err != nil {
 					return fmt.Errorf("failed to start leaf prune; %w", err)
@@ -256,48 +391,46 @@ func (w *sqlWriter) treeLoop(ctx context.Context) error {
 	var (
 		nextPruneVersion int64
 		checkpoints      VersionRange
+		strategy         PruneStrategy
+		pruneDeadline    time.Time
+		pruneInterval    time.Duration
+		pruneBatchRows   []orphanRow
 		pruneVersion     int64
 		pruneCount       int64
 		pruneStartTime   time.Time
 		orphanQuery      *sqlite3.Stmt
-		// TODO use a map
-		deleteBranch func(shardId int64, version int64, sequence int) (err error)
-		deleteOrphan *sqlite3.Stmt
+		treeBatch        KVTreeBatch
 	)
+	// beginPruneBatch runs the orphan scan for both delete paths directly
+	// on treeWrite, but routes the per-row delete path through w.backend's
+	// KVTreeBatch, same as leafLoop does for leaf_orphan.
 	beginPruneBatch := func(version int64) (err error) {
-		if err = w.sql.treeWrite.Begin(); err != nil {
-			return err
+		treeBatch, err = w.backend.BeginTreeBatch(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to begin tree prune batch; %w", err)
 		}
 		orphanQuery, err = w.sql.treeWrite.Prepare(
 			"SELECT version, sequence, at, ROWID FROM orphan WHERE at <= ?", version)
 		if err != nil {
 			return fmt.Errorf("failed to prepare orphan query; %w", err)
 		}
-		deleteBranch = func(shardId int64, version int64, sequence int) (err error) {
-			return w.sql.treeWrite.Exec(
-				fmt.Sprintf("DELETE FROM tree_%d WHERE version = ? AND sequence = ?", shardId), version, sequence)
-		}
-		deleteOrphan, err = w.sql.treeWrite.Prepare("DELETE FROM orphan WHERE ROWID = ?")
-		if err != nil {
-			return fmt.Errorf("failed to prepare orphan delete; %w", err)
-		}
-
-		return err
+		return nil
 	}
 	commitPrune := func() (err error) {
 		if err = orphanQuery.Close(); err != nil {
 			return err
 		}
-		if err = deleteOrphan.Close(); err != nil {
-			return err
-		}
-		if err = w.sql.treeWrite.Commit(); err != nil {
+		if err = treeBatch.Commit(); err != nil {
 			return fmt.Errorf("failed to commit tree prune; %w", err)
 		}
+		treeBatch = nil
 		w.logger.Debug().Msgf("commit tree prune count=%s", humanize.Comma(pruneCount))
 		if err = w.sql.treeWrite.Exec("PRAGMA wal_checkpoint(RESTART)"); err != nil {
 			return fmt.Errorf("failed to checkpoint; %w", err)
 		}
+		if err = w.fireOnPrune(pruneVersion); err != nil {
+			return err
+		}
 		return nil
 	}
 	saveTree := func(sig *saveSignal) {
@@ -309,6 +442,15 @@ func (w *sqlWriter) treeLoop(ctx context.Context) error {
 				res.err = fmt.Errorf("failed to save root path=%s version=%d: %w", w.sql.opts.Path, sig.version, err)
 			}
 		}
+		if res.err == nil {
+			res.err = w.fireOnCommit(CommitContext{
+				Version:      sig.version,
+				RootHash:     rootHash(sig.root),
+				Upserts:      sig.upserts,
+				Deletes:      sig.deletes,
+				IsCheckpoint: sig.wantCheckpoint,
+			})
+		}
 		if sig.batch.isCheckpoint() {
 			if err := w.sql.treeWrite.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
 				res.err = fmt.Errorf("failed tree checkpoint; %w", err)
@@ -317,9 +459,10 @@ func (w *sqlWriter) treeLoop(ctx context.Context) error {
 		w.treeResult <- res
 	}
 	startPrune := func(startPruningVersion int64) error {
-		w.logger.Debug().Msgf("tree prune to version=%d", startPruningVersion)
+		w.logger.Debug().Msgf("tree prune to version=%d strategy=%s", startPruningVersion, strategy)
 		pruneStartTime = time.Now()
 		pruneCount = 0
+		pruneBatchRows = nil
 		pruneVersion = startPruningVersion
 		err := beginPruneBatch(pruneVersion)
 		if err != nil {
@@ -327,6 +470,31 @@ func (w *sqlWriter) treeLoop(ctx context.Context) error {
 		}
 		return nil
 	}
+	shouldYield := func() bool {
+		if pruneCount%pruneBatchSize == 0 {
+			return true
+		}
+		if !pruneDeadline.IsZero() && !time.Now().Before(pruneDeadline) {
+			if pruneInterval > 0 {
+				pruneDeadline = pruneDeadline.Add(pruneInterval)
+			}
+			return true
+		}
+		return false
+	}
+	// flushPendingPruneRows flushes and clears any rows accumulated for the
+	// rowid-range delete path; see leafLoop's copy of the same helper for
+	// why every path into commitPrune must call this first.
+	flushPendingPruneRows := func() error {
+		if !strategy.usesRowidRangeForTree() {
+			return nil
+		}
+		if err := w.flushTreeRowidRange(pruneBatchRows); err != nil {
+			return err
+		}
+		pruneBatchRows = nil
+		return nil
+	}
 	stepPruning := func() error {
 		hasRow, err := orphanQuery.Step()
 		if err != nil {
@@ -348,13 +516,23 @@ func (w *sqlWriter) treeLoop(ctx context.Context) error {
 			if err != nil {
 				return err
 			}
-			if err = deleteBranch(shard, version, sequence); err != nil {
-				return fmt.Errorf("failed to delete from tree_%d count=%d; %w", shard, pruneCount, err)
-			}
-			if err = deleteOrphan.Exec(rowID); err != nil {
-				return fmt.Errorf("failed to delete from orphan count=%d; %w", pruneCount, err)
+			if strategy.usesRowidRangeForTree() {
+				pruneBatchRows = append(pruneBatchRows, orphanRow{version: version, sequence: sequence, shard: shard, rowID: rowID})
+			} else {
+				if err = treeBatch.DeleteBranch(shard, NewNodeKey(version, uint32(sequence))); err != nil {
+					return fmt.Errorf("failed to delete from tree_%d count=%d; %w", shard, pruneCount, err)
+				}
+				if err = treeBatch.DeleteOrphan(NewNodeKey(version, uint32(sequence)), int64(at)); err != nil {
+					return fmt.Errorf("failed to delete from orphan count=%d; %w", pruneCount, err)
+				}
 			}
-			if pruneCount%pruneBatchSize == 0 {
+			if shouldYield() {
+				if strategy.usesRowidRangeForTree() {
+					if err = w.flushTreeRowidRange(pruneBatchRows); err != nil {
+						return err
+					}
+					pruneBatchRows = nil
+				}
 				if err = commitPrune(); err != nil {
 					return err
 				}
@@ -363,6 +541,12 @@ func (w *sqlWriter) treeLoop(ctx context.Context) error {
 				}
 			}
 		} else {
+			if strategy.usesRowidRangeForTree() {
+				if err = w.flushTreeRowidRange(pruneBatchRows); err != nil {
+					return err
+				}
+				pruneBatchRows = nil
+			}
 			if err = commitPrune(); err != nil {
 				return err
 			}
@@ -377,6 +561,7 @@ func (w *sqlWriter) treeLoop(ctx context.Context) error {
 				time.Since(pruneStartTime).Round(time.Millisecond),
 				prevCheckpoint,
 			)
+			w.recordPruneStrategy("tree", strategy, time.Since(pruneStartTime), pruneCount)
 			if nextPruneVersion != 0 {
 				if err = startPrune(nextPruneVersion); err != nil {
 					return err
@@ -396,6 +581,9 @@ func (w *sqlWriter) treeLoop(ctx context.Context) error {
 			select {
 			case sig := <-w.treeCh:
 				if sig.wantCheckpoint {
+					if err := flushPendingPruneRows(); err != nil {
+						return err
+					}
 					if err := commitPrune(); err != nil {
 						return err
 					}
@@ -409,7 +597,20 @@ func (w *sqlWriter) treeLoop(ctx context.Context) error {
 			case sig := <-w.treePruneCh:
 				w.logger.Warn().Msgf("tree prune signal received while pruning version=%d next=%d", pruneVersion, sig.pruneVersion)
 				checkpoints = sig.checkpoints
+				strategy = sig.strategy
+				pruneDeadline, pruneInterval = sig.deadline, deadlineInterval(sig.deadline)
 				nextPruneVersion = sig.pruneVersion
+			case sig := <-w.treeMergeCh:
+				if err := flushPendingPruneRows(); err != nil {
+					return err
+				}
+				if err := commitPrune(); err != nil {
+					return err
+				}
+				sig.done <- w.mergeTreeRecords(sig.batch)
+				if err := beginPruneBatch(pruneVersion); err != nil {
+					return err
+				}
 			case <-ctx.Done():
 				return nil
 			default:
@@ -423,8 +624,12 @@ func (w *sqlWriter) treeLoop(ctx context.Context) error {
 			select {
 			case sig := <-w.treeCh:
 				saveTree(sig)
+			case sig := <-w.treeMergeCh:
+				sig.done <- w.mergeTreeRecords(sig.batch)
 			case sig := <-w.treePruneCh:
 				checkpoints = sig.checkpoints
+				strategy = sig.strategy
+				pruneDeadline, pruneInterval = sig.deadline, deadlineInterval(sig.deadline)
 				err := startPrune(sig.pruneVersion)
 				if err != nil {
 					return err
@@ -436,10 +641,33 @@ func (w *sqlWriter) treeLoop(ctx context.Context) error {
 	}
 }
 
+// saveTree hands a staged tree's writes off to the writer. When the WAL is
+// enabled, it appends the batch's records and the staged root, fsyncs, and
+// acks as soon as that append is durable - the shards themselves are caught
+// up afterward by mergeLoop handing the decoded records to treeLoop/
+// leafLoop. That keeps commit latency bounded by one sequential append
+// instead of an append plus a synchronous SQLite round trip for the same
+// data. Without a WAL, it falls back to the original synchronous path:
+// write straight through treeCh/leafCh and wait for both results.
 func (w *sqlWriter) saveTree(tree *Tree) error {
 	saveStart := time.Now()
-	parts := strings.Split(tree.sql.opts.Path, "/")
 
+	if w.wal != nil {
+		rootPayload, err := walRootPayload(tree.stagedRoot, tree.shouldCheckpoint)
+		if err != nil {
+			return fmt.Errorf("failed to encode staged root for wal; %w", err)
+		}
+		if err := w.wal.appendBatch(tree.stagedVersion, walRecordsForTree(tree), rootPayload); err != nil {
+			return fmt.Errorf("failed to append wal batch version=%d; %w", tree.stagedVersion, err)
+		}
+		dur := time.Since(saveStart)
+		tree.sql.metrics.WriteDurations = append(tree.sql.metrics.WriteDurations, dur)
+		tree.sql.metrics.WriteTime += dur
+		tree.sql.metrics.WriteLeaves += int64(len(tree.leaves))
+		return nil
+	}
+
+	parts := strings.Split(tree.sql.opts.Path, "/")
 	batch := &sqliteBatch{
 		sql:               tree.sql,
 		queue:             tree.writeQueue,
@@ -450,7 +678,19 @@ func (w *sqlWriter) saveTree(tree *Tree) error {
 			Str("module", "sqlite-batch").
 			Str("path", parts[len(parts)-1]).Logger(),
 	}
-	saveSig := &saveSignal{batch: batch, root: tree.stagedRoot, version: tree.stagedVersion, wantCheckpoint: tree.shouldCheckpoint}
+	upserts := make(map[string][]byte, len(tree.leaves))
+	for _, n := range tree.leaves {
+		upserts[string(n.Key)] = n.Value
+	}
+	saveSig := &saveSignal{
+		batch:          batch,
+		root:           tree.stagedRoot,
+		version:        tree.stagedVersion,
+		wantCheckpoint: tree.shouldCheckpoint,
+		upserts:        upserts,
+		deletes:        tree.deletes,
+	}
+
 	w.treeCh <- saveSig
 	w.leafCh <- saveSig
 	treeResult := <-w.treeResult
@@ -460,21 +700,34 @@ func (w *sqlWriter) saveTree(tree *Tree) error {
 	tree.sql.metrics.WriteTime += dur
 	tree.sql.metrics.WriteLeaves += int64(len(tree.leaves))
 
-	//if batch.leafCount > 0 || batch.treeCount > 0 {
-	//	batch.logger.Info().Msgf("saved tree version=%d leaves=%s branches=%s dur=%s",
-	//		tree.stagedVersion,
-	//		humanize.Comma(batch.leafCount),
-	//		humanize.Comma(batch.treeCount),
-	//		dur.Round(time.Millisecond),
-	//	)
-	//}
-
-	err := errors.Join(treeResult.err, leafResult.err)
-
-	return err
+	return errors.Join(treeResult.err, leafResult.err)
 }
 
-// TODO
-// unify delete approach between tree and leaf. tree uses rowid range in delete, leaf issues delete for each rowid.
-// which one is faster?
+// Delete strategy (rowid-range vs per-row, for both tree and leaf) is
+// selectable via PruneStrategy and timed per run in pruneStrategyStats, so
+// which one is faster can be answered from real data instead of guessed
+// at; see prune_strategy.go and prune_rowid_range.go.
+
+// prune asks both writer loops to begin pruning orphaned rows at or before
+// pruneVersion, within the given checkpoint boundaries, using strategy for
+// the delete path. yieldAfter, if non-zero, bounds how long a loop runs a
+// single prune batch before checking for an interrupting saveTree/merge
+// signal; zero falls back to yielding only at pruneBatchSize boundaries.
 //
+// There is no SqliteDbOptions field yet for an operator to pick strategy or
+// yieldAfter at open time (see BackendKind's doc comment for the same gap
+// on KVBackend), so today this is only reachable by calling it directly.
+func (w *sqlWriter) prune(pruneVersion int64, checkpoints VersionRange, strategy PruneStrategy, yieldAfter time.Duration) {
+	var deadline time.Time
+	if yieldAfter > 0 {
+		deadline = time.Now().Add(yieldAfter)
+	}
+	sig := &pruneSignal{
+		pruneVersion: pruneVersion,
+		checkpoints:  checkpoints,
+		strategy:     strategy,
+		deadline:     deadline,
+	}
+	w.treePruneCh <- sig
+	w.leafPruneCh <- sig
+}
@@ -0,0 +1,632 @@
+package iavl
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// walRecordKind identifies the payload framed in a single WAL record.
+type walRecordKind byte
+
+const (
+	walKindLeaf walRecordKind = iota + 1
+	walKindBranch
+	walKindRoot
+	walKindOrphan
+	walKindCommit
+	walKindDelete
+)
+
+// walRecord is the decoded form of a single WAL entry. On disk a record is
+// framed as [len uint32][crc32 uint32][version int64][kind byte][payload].
+type walRecord struct {
+	version int64
+	kind    walRecordKind
+	payload []byte
+}
+
+const walHeaderSize = 4 + 4 + 8 + 1 // len + crc32 + version + kind
+
+func writeWALRecord(w io.Writer, rec *walRecord) (int, error) {
+	buf := make([]byte, walHeaderSize+len(rec.payload))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(rec.version))
+	buf[16] = byte(rec.kind)
+	copy(buf[walHeaderSize:], rec.payload)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(rec.payload)))
+	crc := crc32.ChecksumIEEE(buf[8:])
+	binary.BigEndian.PutUint32(buf[4:8], crc)
+	return w.Write(buf)
+}
+
+// readWALRecord reads and validates a single record. io.EOF is returned
+// (unwrapped) when the stream ends cleanly on a record boundary; any other
+// error, including a partial read, indicates a torn tail written before a
+// crash and should be treated as the end of usable log data.
+func readWALRecord(r io.Reader) (*walRecord, error) {
+	hdr := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[0:4])
+	wantCRC := binary.BigEndian.Uint32(hdr[4:8])
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("torn wal record: %w", err)
+	}
+	sum := crc32.NewIEEE()
+	_, _ = sum.Write(hdr[8:])
+	_, _ = sum.Write(payload)
+	if sum.Sum32() != wantCRC {
+		return nil, fmt.Errorf("wal record checksum mismatch at version=%d kind=%d",
+			int64(binary.BigEndian.Uint64(hdr[8:16])), hdr[16])
+	}
+	return &walRecord{
+		version: int64(binary.BigEndian.Uint64(hdr[8:16])),
+		kind:    walRecordKind(hdr[16]),
+		payload: payload,
+	}, nil
+}
+
+// walSegmentMaxBytes is the rotation threshold for a single wal-<seq>.log
+// file. Kept well under typical filesystem blob limits so a segment can be
+// merged and removed without ever becoming a long-lived large file.
+const walSegmentMaxBytes = 64 << 20
+
+// walRotateInterval bounds how long a segment can stay active by size
+// alone. Under steady, modest-sized commit traffic a segment can take far
+// longer than that to reach walSegmentMaxBytes, and mergeLoop only ever
+// drains closed segments - without a second, time-based trigger a
+// just-committed version would sit unmerged, and therefore unreadable from
+// the SQLite shards, until the process restarts and recoverWAL runs.
+const walRotateInterval = 5 * time.Second
+
+// walManager owns the rotating append-only log that sits in front of the
+// SQLite shards. saveTree appends a commit's leaf/branch/root records here,
+// fsyncs, and acks the caller without touching a SQLite connection at all;
+// sqlWriter's background merger then drains closed segments and hands the
+// decoded records to the tree/leaf loops - the same goroutines that already
+// own treeWrite/leafWrite - so commit latency is bounded by sequential disk
+// I/O rather than a SQLite transaction, and the merger never contends with
+// the loops for a connection that isn't safe for concurrent use.
+type walManager struct {
+	mu         sync.Mutex
+	dir        string
+	seq        int64
+	file       *os.File
+	size       int64
+	lastRotate time.Time
+	logger     zerolog.Logger
+}
+
+func newWALManager(dir string, logger zerolog.Logger) (*walManager, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create wal dir %s; %w", dir, err)
+	}
+	w := &walManager{dir: dir, logger: logger.With().Str("module", "wal").Logger()}
+	// Continue numbering after any segments a previous run left behind, so
+	// the new active segment never collides with one recoverWAL replays.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wal dir %s; %w", dir, err)
+	}
+	for _, e := range entries {
+		var seq int64
+		if _, err := fmt.Sscanf(e.Name(), "wal-%d.log", &seq); err == nil && seq > w.seq {
+			w.seq = seq
+		}
+	}
+	if err := w.openNextSegment(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *walManager) segmentPath(seq int64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("wal-%012d.log", seq))
+}
+
+func (w *walManager) openNextSegment() error {
+	w.seq++
+	f, err := os.OpenFile(w.segmentPath(w.seq), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open wal segment %d; %w", w.seq, err)
+	}
+	w.file = f
+	w.size = 0
+	w.lastRotate = time.Now()
+	return nil
+}
+
+// appendBatch writes every record in the batch followed by a trailing
+// commit record carrying the staged root, then fsyncs the segment. It only
+// returns once the records are durable, so the caller may ack immediately
+// after.
+func (w *walManager) appendBatch(version int64, records []*walRecord, rootPayload []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, rec := range records {
+		n, err := writeWALRecord(w.file, rec)
+		if err != nil {
+			return fmt.Errorf("failed to append wal record version=%d kind=%d; %w", rec.version, rec.kind, err)
+		}
+		w.size += int64(n)
+	}
+	n, err := writeWALRecord(w.file, &walRecord{version: version, kind: walKindCommit, payload: rootPayload})
+	if err != nil {
+		return fmt.Errorf("failed to append wal commit record version=%d; %w", version, err)
+	}
+	w.size += int64(n)
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to fsync wal segment %d; %w", w.seq, err)
+	}
+
+	// rootPayload's first byte is the checkpoint flag (see walRootPayload);
+	// rotating on a checkpoint commit means a checkpoint is always promptly
+	// merged rather than left waiting behind the size/time thresholds below.
+	wantCheckpoint := len(rootPayload) > 0 && rootPayload[0] != 0
+	if w.size >= walSegmentMaxBytes || wantCheckpoint || time.Since(w.lastRotate) >= walRotateInterval {
+		return w.rotate()
+	}
+	return nil
+}
+
+// rotate closes the active segment and opens the next one. The closed
+// segment becomes eligible for the background merger to drain.
+func (w *walManager) rotate() error {
+	closed := w.file
+	closedSeq := w.seq
+	if err := closed.Close(); err != nil {
+		return fmt.Errorf("failed to close wal segment %d; %w", closedSeq, err)
+	}
+	w.logger.Debug().Int64("seq", closedSeq).Msg("rotated wal segment")
+	return w.openNextSegment()
+}
+
+// closedSegments lists segment files other than the currently active one,
+// in ascending seq order, for the merger to drain.
+func (w *walManager) closedSegments() ([]string, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wal dir %s; %w", w.dir, err)
+	}
+	active := filepath.Base(w.segmentPath(w.seq))
+	var segments []string
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == active {
+			continue
+		}
+		segments = append(segments, filepath.Join(w.dir, e.Name()))
+	}
+	sort.Strings(segments)
+	return segments, nil
+}
+
+// walSegmentRecords reads every record in a segment up to (but excluding)
+// the first torn or invalid record, mirroring the recovery semantics used
+// at open: a commit record present at the end means the segment is whole.
+func walSegmentRecords(path string) (records []*walRecord, hasTrailingCommit bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	for {
+		rec, err := readWALRecord(f)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			// torn tail or corruption: stop here, discard the rest.
+			break
+		}
+		records = append(records, rec)
+		if rec.kind == walKindCommit {
+			hasTrailingCommit = true
+		} else {
+			hasTrailingCommit = false
+		}
+	}
+	return records, hasTrailingCommit, nil
+}
+
+// recoverWAL replays every closed segment whose trailing commit record is
+// present, applying leaf/branch/orphan records and the staged root into the
+// shards, and removes segments as they are fully replayed. Segments with no
+// trailing commit (a crash mid-append) are discarded after their usable
+// prefix is logged. This is called once from SqliteDb open, before the
+// tree/leaf loops start, so it can use treeWrite/leafWrite directly - there
+// is no other goroutine touching them yet - and crash consistency is
+// provided by the log rather than by SQLite's own WAL.
+func (w *sqlWriter) recoverWAL() error {
+	if w.wal == nil {
+		return nil
+	}
+	segments, err := w.wal.closedSegments()
+	if err != nil {
+		return err
+	}
+	for _, path := range segments {
+		records, committed, err := walSegmentRecords(path)
+		if err != nil {
+			return fmt.Errorf("failed to read wal segment %s; %w", path, err)
+		}
+		if !committed {
+			w.logger.Warn().Str("segment", path).Msg("discarding wal segment with no trailing commit record")
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove incomplete wal segment %s; %w", path, err)
+			}
+			continue
+		}
+		batch, err := decodeWALBatch(records)
+		if err != nil {
+			return fmt.Errorf("failed to decode wal segment %s; %w", path, err)
+		}
+		if err := w.mergeTreeRecords(batch); err != nil {
+			return fmt.Errorf("failed to recover wal segment %s (tree); %w", path, err)
+		}
+		if err := w.mergeLeafRecords(batch); err != nil {
+			return fmt.Errorf("failed to recover wal segment %s (leaf); %w", path, err)
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove merged wal segment %s; %w", path, err)
+		}
+		w.logger.Info().Str("segment", path).Int("records", len(records)).Msg("recovered wal segment")
+	}
+	return nil
+}
+
+// walMergePollInterval is how often the merger checks for newly closed
+// segments when it has drained everything it could see.
+const walMergePollInterval = 200 * time.Millisecond
+
+// walMergeSignal hands a decoded segment to the tree or leaf loop so the
+// write happens on the connection that goroutine already owns exclusively,
+// instead of the merger opening or sharing a connection of its own.
+type walMergeSignal struct {
+	batch *walDecodedBatch
+	done  chan error
+}
+
+// mergeLoop drains closed WAL segments in the background and dispatches
+// each one's decoded records to treeLoop and leafLoop over treeMergeCh and
+// leafMergeCh, waiting for both to apply before removing the segment. It
+// never calls treeWrite/leafWrite itself, since those connections are not
+// safe for concurrent use across goroutines - only the loop that already
+// owns a connection may use it, even for merge work.
+func (w *sqlWriter) mergeLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(walMergePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		segments, err := w.wal.closedSegments()
+		if err != nil {
+			w.logger.Err(err).Msg("wal merger failed to list segments")
+			continue
+		}
+		for _, path := range segments {
+			records, committed, err := walSegmentRecords(path)
+			if err != nil || !committed {
+				// an in-progress rotation races the merger here; leave the
+				// segment for the next pass rather than treating it as torn.
+				continue
+			}
+			batch, err := decodeWALBatch(records)
+			if err != nil {
+				w.logger.Err(err).Str("segment", path).Msg("wal merger failed to decode segment")
+				continue
+			}
+			treeDone := make(chan error, 1)
+			leafDone := make(chan error, 1)
+			select {
+			case w.treeMergeCh <- &walMergeSignal{batch: batch, done: treeDone}:
+			case <-stop:
+				return
+			}
+			select {
+			case w.leafMergeCh <- &walMergeSignal{batch: batch, done: leafDone}:
+			case <-stop:
+				return
+			}
+			if err := errors.Join(<-treeDone, <-leafDone); err != nil {
+				w.logger.Err(err).Str("segment", path).Msg("wal merger failed")
+				continue
+			}
+			// Hooks fire here, once both sides are durable, rather than in
+			// either loop, so a version is reported exactly once regardless
+			// of which connection finishes last. A hook rejection cannot
+			// fail the commit - the caller already acked at the WAL fsync -
+			// so it is only logged; see OnCommit's doc comment.
+			if err := w.fireOnCommit(CommitContext{
+				Version:      batch.version,
+				RootHash:     batch.rootHash(),
+				Upserts:      batch.upserts,
+				Deletes:      batch.deletes,
+				IsCheckpoint: batch.wantCheckpoint,
+			}); err != nil {
+				w.logger.Err(err).Int64("version", batch.version).Msg("commit hook rejected merged wal batch")
+			}
+			if err := os.Remove(path); err != nil {
+				w.logger.Err(err).Str("segment", path).Msg("wal merger failed to remove segment")
+			}
+		}
+	}
+}
+
+// mergeTreeRecords applies a decoded batch's branch and orphan records,
+// then the staged root, through w.backend's KVTreeBatch. Called either from
+// recoverWAL (before the loops start) or from treeLoop in response to
+// treeMergeCh, so it is always the sole user of the tree backend at the
+// time it runs.
+func (w *sqlWriter) mergeTreeRecords(batch *walDecodedBatch) error {
+	treeBatch, err := w.backend.BeginTreeBatch(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to begin wal merge tree batch; %w", err)
+	}
+	for _, rec := range batch.branchRecords {
+		if err := w.mergeBranchRecord(treeBatch, rec); err != nil {
+			_ = treeBatch.Rollback()
+			return err
+		}
+	}
+	for _, rec := range batch.orphanRecords {
+		if err := w.mergeOrphanRecord(treeBatch, rec); err != nil {
+			_ = treeBatch.Rollback()
+			return err
+		}
+	}
+	if err := treeBatch.Commit(); err != nil {
+		return fmt.Errorf("failed to commit wal merge tree batch; %w", err)
+	}
+	// SaveRoot tolerates a nil root (an empty tree, or a version that
+	// deleted every key), so it's called unconditionally here, matching the
+	// non-WAL save path.
+	if err := w.sql.SaveRoot(batch.version, batch.root, batch.wantCheckpoint); err != nil {
+		return fmt.Errorf("failed to save merged root version=%d; %w", batch.version, err)
+	}
+	if batch.wantCheckpoint {
+		if err := w.sql.treeWrite.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			return fmt.Errorf("failed tree checkpoint after wal merge; %w", err)
+		}
+	}
+	return nil
+}
+
+// mergeLeafRecords is mergeTreeRecords' counterpart for w.backend's
+// KVLeafBatch.
+func (w *sqlWriter) mergeLeafRecords(batch *walDecodedBatch) error {
+	leafBatch, err := w.backend.BeginLeafBatch(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to begin wal merge leaf batch; %w", err)
+	}
+	for _, rec := range batch.leafRecords {
+		if err := w.mergeLeafRecord(leafBatch, rec); err != nil {
+			_ = leafBatch.Rollback()
+			return err
+		}
+	}
+	if err := leafBatch.Commit(); err != nil {
+		return fmt.Errorf("failed to commit wal merge leaf batch; %w", err)
+	}
+	if batch.wantCheckpoint {
+		if err := w.sql.leafWrite.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			return fmt.Errorf("failed leaf checkpoint after wal merge; %w", err)
+		}
+	}
+	return nil
+}
+
+// walDecodedBatch groups one commit's WAL records by kind, plus the decoded
+// root and leaf upserts needed to fire commit hooks once the merge lands,
+// without either tree/leaf loop having to decode records meant for the
+// other's connection.
+type walDecodedBatch struct {
+	version        int64
+	branchRecords  []*walRecord
+	leafRecords    []*walRecord
+	orphanRecords  []*walRecord
+	root           *Node
+	wantCheckpoint bool
+	upserts        map[string][]byte
+	deletes        [][]byte
+}
+
+func (b *walDecodedBatch) rootHash() []byte {
+	if b.root == nil {
+		return nil
+	}
+	return b.root.Hash()
+}
+
+// decodeWALBatch splits a segment's records by kind and decodes the leaf
+// values and trailing root, ready to hand to mergeTreeRecords/
+// mergeLeafRecords and to fireOnCommit.
+func decodeWALBatch(records []*walRecord) (*walDecodedBatch, error) {
+	b := &walDecodedBatch{upserts: make(map[string][]byte)}
+	for _, rec := range records {
+		switch rec.kind {
+		case walKindBranch:
+			b.branchRecords = append(b.branchRecords, rec)
+			b.version = rec.version
+		case walKindLeaf:
+			b.leafRecords = append(b.leafRecords, rec)
+			b.version = rec.version
+			n, err := MakeNode(rec.payload[:12], rec.payload[12:])
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode wal leaf record version=%d; %w", rec.version, err)
+			}
+			b.upserts[string(n.Key)] = n.Value
+		case walKindOrphan:
+			b.orphanRecords = append(b.orphanRecords, rec)
+		case walKindDelete:
+			b.version = rec.version
+			b.deletes = append(b.deletes, rec.payload)
+		case walKindCommit:
+			b.version = rec.version
+			if len(rec.payload) < 1 {
+				return nil, fmt.Errorf("short wal commit payload version=%d", rec.version)
+			}
+			b.wantCheckpoint = rec.payload[0] != 0
+			if len(rec.payload) == 1 {
+				// nil staged root - see walRootPayload.
+				b.root = nil
+				continue
+			}
+			if len(rec.payload) < 1+12 {
+				return nil, fmt.Errorf("short wal commit payload version=%d", rec.version)
+			}
+			root, err := MakeNode(rec.payload[1:13], rec.payload[13:])
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode wal root version=%d; %w", rec.version, err)
+			}
+			b.root = root
+		}
+	}
+	return b, nil
+}
+
+// walRecordsForTree encodes a staged tree's pending branches, leaves,
+// orphaned node keys and deleted keys into WAL records, in the same order
+// saveBranches/saveLeaves/the orphan writer would apply them, so replaying
+// them on merge or recovery is equivalent to the synchronous path. Deletes
+// are carried along so a WAL-backed commit hook sees the same
+// CommitContext.Deletes its non-WAL counterpart does.
+func walRecordsForTree(tree *Tree) []*walRecord {
+	records := make([]*walRecord, 0, len(tree.writeQueue)+len(tree.leaves)+len(tree.orphans)+len(tree.deletes))
+	for _, n := range tree.writeQueue {
+		bz := &bytes.Buffer{}
+		if err := n.WriteBytes(bz); err != nil {
+			continue
+		}
+		records = append(records, &walRecord{version: tree.stagedVersion, kind: walKindBranch, payload: append(append([]byte{}, n.NodeKey[:]...), bz.Bytes()...)})
+	}
+	for _, n := range tree.leaves {
+		bz := &bytes.Buffer{}
+		if err := n.WriteBytes(bz); err != nil {
+			continue
+		}
+		records = append(records, &walRecord{version: tree.stagedVersion, kind: walKindLeaf, payload: append(append([]byte{}, n.NodeKey[:]...), bz.Bytes()...)})
+	}
+	for _, nk := range tree.orphans {
+		records = append(records, &walRecord{version: tree.stagedVersion, kind: walKindOrphan, payload: append([]byte{}, nk[:]...)})
+	}
+	for _, key := range tree.deletes {
+		records = append(records, &walRecord{version: tree.stagedVersion, kind: walKindDelete, payload: append([]byte{}, key...)})
+	}
+	return records
+}
+
+// walRootPayload encodes the staged root for the trailing commit record:
+// a checkpoint flag byte, the root's node key and its node bytes, so the
+// merger can reconstruct both SaveRoot's arguments and the root hash for
+// commit hooks without any other side channel.
+// walRootPayload encodes the staged root for the trailing commit record. A
+// nil root (an empty tree, or a version that deleted every key) encodes to
+// just the checkpoint flag byte - decodeWALBatch treats that short payload
+// as "no root this version" rather than trying to decode a NodeKey out of
+// it, matching SaveRoot's existing tolerance for a nil root.
+func walRootPayload(root *Node, wantCheckpoint bool) ([]byte, error) {
+	flag := byte(0)
+	if wantCheckpoint {
+		flag = 1
+	}
+	if root == nil {
+		return []byte{flag}, nil
+	}
+	bz := &bytes.Buffer{}
+	if err := root.WriteBytes(bz); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, 0, 1+12+bz.Len())
+	payload = append(payload, flag)
+	payload = append(payload, root.NodeKey[:]...)
+	payload = append(payload, bz.Bytes()...)
+	return payload, nil
+}
+
+// DumpWALSegment prints every record in a wal-<seq>.log segment to out, one
+// line per record, for offline debugging via the walinspect CLI. It stops
+// at the first torn or invalid record rather than erroring, noting the
+// index of the record it stopped at and the read error.
+func DumpWALSegment(path string, out io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var i int
+	for {
+		rec, err := readWALRecord(f)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			fmt.Fprintf(out, "record %d: stopping, torn or corrupt tail: %v\n", i, err)
+			return nil
+		}
+		fmt.Fprintf(out, "record %d: version=%d kind=%s len=%d\n", i, rec.version, rec.kind, len(rec.payload))
+		i++
+	}
+}
+
+func (k walRecordKind) String() string {
+	switch k {
+	case walKindLeaf:
+		return "leaf"
+	case walKindBranch:
+		return "branch"
+	case walKindRoot:
+		return "root"
+	case walKindOrphan:
+		return "orphan"
+	case walKindCommit:
+		return "commit"
+	case walKindDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(k))
+	}
+}
+
+func (w *sqlWriter) mergeBranchRecord(treeBatch KVTreeBatch, rec *walRecord) error {
+	nk := rec.payload[:12]
+	shard, err := w.sql.getShard(rec.version)
+	if err != nil {
+		return fmt.Errorf("failed to resolve shard for wal branch record version=%d; %w", rec.version, err)
+	}
+	return treeBatch.PutBranch(shard, NewNodeKey(rec.version, binary.BigEndian.Uint32(nk[8:])), rec.payload[12:])
+}
+
+func (w *sqlWriter) mergeLeafRecord(leafBatch KVLeafBatch, rec *walRecord) error {
+	nk := rec.payload[:12]
+	return leafBatch.PutLeaf(rec.version, int(binary.BigEndian.Uint32(nk[8:])), rec.payload[12:])
+}
+
+// mergeOrphanRecord inserts an orphan row for the node key that was
+// replaced, keyed by the orphaned node's own (version, sequence), with "at"
+// set to the WAL record's commit version - the version that did the
+// orphaning - not the orphaned node's own version.
+func (w *sqlWriter) mergeOrphanRecord(treeBatch KVTreeBatch, rec *walRecord) error {
+	nk := rec.payload[:12]
+	version := int64(binary.BigEndian.Uint64(nk[0:8]))
+	sequence := binary.BigEndian.Uint32(nk[8:12])
+	return treeBatch.PutOrphan(NewNodeKey(version, sequence), rec.version)
+}